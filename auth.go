@@ -0,0 +1,267 @@
+package ripple
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// The authenticated client of a request, as set by the Auth middleware
+// and returned by Context.Principal().
+type Principal struct {
+	// The name of the user, API key, etc. that has been authenticated.
+	Name string
+	// The roles and scopes granted to the principal. See Policy.
+	Roles  []string
+	Scopes []string
+	// The claims carried by the credentials, if any. For example the claims
+	// of a JWT token (see JwtAuthenticator).
+	Claims map[string]interface{}
+	// Any additional data provided by the authenticator, for example the
+	// user object loaded from the database.
+	Data interface{}
+}
+
+// Tells whether the principal has the given role.
+func (this *Principal) HasRole(role string) bool {
+	return containsString(this.Roles, role)
+}
+
+// Tells whether the principal has the given scope.
+func (this *Principal) HasScope(scope string) bool {
+	return containsString(this.Scopes, scope)
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Returned by the authenticators when the request contains credentials
+// that are not valid.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// An authenticator identifies the client of a request from the credentials
+// it contains. See BasicAuthenticator, BearerAuthenticator and
+// ApiKeyAuthenticator for the built-in ones.
+type Authenticator interface {
+	// Returns the principal identified by the request. If the request does
+	// not contain any credentials for this authenticator, it returns nil
+	// and no error. If the credentials are not valid, it returns an error.
+	Authenticate(request *http.Request) (*Principal, error)
+	// Returns the value of the WWW-Authenticate header sent along with 401
+	// responses, or an empty string if there is none. err is the error
+	// returned by Authenticate(), or nil if no credentials were provided.
+	Challenge(err error) string
+}
+
+// Verifies a set of credentials and returns the matching principal. It
+// returns nil or an error if the credentials are not valid.
+type CredentialsVerifier func(credentials string) (*Principal, error)
+
+func verifyCredentials(verify func() (*Principal, error)) (*Principal, error) {
+	principal, err := verify()
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return principal, nil
+}
+
+// Authenticates the requests using HTTP Basic authentication.
+type BasicAuthenticator struct {
+	Realm string
+	// Verifies the username and password. Returns nil or an error if they are not valid.
+	Verify func(username string, password string) (*Principal, error)
+}
+
+// Build a new Basic authenticator.
+func NewBasicAuthenticator(realm string, verify func(username string, password string) (*Principal, error)) *BasicAuthenticator {
+	output := new(BasicAuthenticator)
+	output.Realm = realm
+	output.Verify = verify
+	return output
+}
+
+// Implementation of Authenticator.
+func (this *BasicAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	if !hasAuthorizationScheme(request, "Basic") {
+		return nil, nil
+	}
+	username, password, ok := request.BasicAuth()
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return verifyCredentials(func() (*Principal, error) {
+		return this.Verify(username, password)
+	})
+}
+
+// Implementation of Authenticator.
+func (this *BasicAuthenticator) Challenge(err error) string {
+	return fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", this.Realm)
+}
+
+// Authenticates the requests using Bearer tokens, as defined in RFC 6750.
+type BearerAuthenticator struct {
+	Realm string
+	// Verifies the token. Returns nil or an error if it is not valid.
+	Verify CredentialsVerifier
+}
+
+// Build a new Bearer token authenticator.
+func NewBearerAuthenticator(realm string, verify CredentialsVerifier) *BearerAuthenticator {
+	output := new(BearerAuthenticator)
+	output.Realm = realm
+	output.Verify = verify
+	return output
+}
+
+// Implementation of Authenticator.
+func (this *BearerAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	if !hasAuthorizationScheme(request, "Bearer") {
+		return nil, nil
+	}
+	token := strings.TrimSpace(request.Header.Get("Authorization")[len("Bearer"):])
+	if token == "" {
+		return nil, ErrInvalidCredentials
+	}
+	return verifyCredentials(func() (*Principal, error) {
+		return this.Verify(token)
+	})
+}
+
+// Implementation of Authenticator.
+func (this *BearerAuthenticator) Challenge(err error) string {
+	if err != nil {
+		return fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\"", this.Realm)
+	}
+	return fmt.Sprintf("Bearer realm=%q", this.Realm)
+}
+
+// Authenticates the requests using an API key, provided either in a header
+// or in a query parameter.
+type ApiKeyAuthenticator struct {
+	// The header that contains the key (default to "X-API-Key"). Leave
+	// empty to disable.
+	Header string
+	// The query parameter that contains the key. Leave empty (the default)
+	// to disable. Note that query parameters tend to end up in access logs.
+	QueryParam string
+	// Verifies the key. Returns nil or an error if it is not valid.
+	Verify CredentialsVerifier
+}
+
+// Build a new API key authenticator.
+func NewApiKeyAuthenticator(verify CredentialsVerifier) *ApiKeyAuthenticator {
+	output := new(ApiKeyAuthenticator)
+	output.Header = "X-API-Key"
+	output.Verify = verify
+	return output
+}
+
+// Implementation of Authenticator.
+func (this *ApiKeyAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	key := ""
+	if this.Header != "" {
+		key = request.Header.Get(this.Header)
+	}
+	if key == "" && this.QueryParam != "" {
+		key = request.URL.Query().Get(this.QueryParam)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	return verifyCredentials(func() (*Principal, error) {
+		return this.Verify(key)
+	})
+}
+
+// Implementation of Authenticator. There is no standard challenge for API
+// keys so none is sent.
+func (this *ApiKeyAuthenticator) Challenge(err error) string {
+	return ""
+}
+
+func hasAuthorizationScheme(request *http.Request, scheme string) bool {
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) < len(scheme) || !strings.EqualFold(authorization[0:len(scheme)], scheme) {
+		return false
+	}
+	return len(authorization) == len(scheme) || authorization[len(scheme)] == ' '
+}
+
+// A middleware that authenticates the requests and sets the principal on the
+// context. Use NewAuth() to build it, then register it for the whole
+// application, a group of routes or a controller:
+//
+//	auth := ripple.NewAuth(ripple.NewBearerAuthenticator("api", verifyToken))
+//	app.Use(auth.Handle)
+//	app.UseController("users", auth.Handle)
+//	adminGroup.Use(auth.Handle)
+//
+// If the request does not contain valid credentials, the client receives a
+// 401 Unauthorized response along with the WWW-Authenticate challenges of
+// the authenticators.
+type Auth struct {
+	// The authenticators, tried in order until one of them finds credentials
+	// in the request.
+	Authenticators []Authenticator
+	// If true, requests that do not contain any credentials are let through
+	// without principal. Requests with invalid credentials are still rejected.
+	Optional bool
+}
+
+// Build a new authentication middleware.
+func NewAuth(authenticators ...Authenticator) *Auth {
+	output := new(Auth)
+	output.Authenticators = authenticators
+	return output
+}
+
+// Implementation of Middleware.
+func (this *Auth) Handle(ctx *Context, next func()) {
+	for _, authenticator := range this.Authenticators {
+		principal, err := authenticator.Authenticate(ctx.Request)
+		if err != nil {
+			this.reject(ctx, err)
+			return
+		}
+		if principal != nil {
+			ctx.SetPrincipal(principal)
+			next()
+			return
+		}
+	}
+
+	if this.Optional {
+		next()
+		return
+	}
+	this.reject(ctx, nil)
+}
+
+func (this *Auth) reject(ctx *Context, err error) {
+	for _, authenticator := range this.Authenticators {
+		challenge := authenticator.Challenge(err)
+		if challenge != "" {
+			ctx.Response.Header.Add("WWW-Authenticate", challenge)
+		}
+	}
+	message := ""
+	if err != nil {
+		// The actual error may come from the verifier and reveal some
+		// internal details, so it is only logged.
+		log.Printf("[%s] Authentication failed: %s\n", ctx.RequestID(), err)
+		message = "Invalid credentials"
+	}
+	ctx.Error(http.StatusUnauthorized, message)
+}
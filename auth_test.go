@@ -0,0 +1,158 @@
+package ripple
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHasAuthorizationScheme(t *testing.T) {
+	type SchemeTest struct {
+		header   string
+		scheme   string
+		expected bool
+	}
+	var schemeTests = []SchemeTest{
+		{"Bearer abcd", "Bearer", true},
+		{"bearer abcd", "Bearer", true},
+		{"Bearer", "Bearer", true},
+		{"Bearerabcd", "Bearer", false},
+		{"Basic abcd", "Bearer", false},
+		{"", "Basic", false},
+	}
+	for _, d := range schemeTests {
+		var reader io.Reader
+		request, _ := http.NewRequest("GET", "/", reader)
+		request.Header.Set("Authorization", d.header)
+		if hasAuthorizationScheme(request, d.scheme) != d.expected {
+			t.Errorf("%s %s: Expected %t", d.header, d.scheme, d.expected)
+		}
+	}
+}
+
+type ControllerAuthTesters struct {
+	Principal *Principal
+}
+
+func (this *ControllerAuthTesters) Get(ctx *Context) {
+	this.Principal = ctx.Principal()
+}
+
+func TestAuth(t *testing.T) {
+	basic := NewBasicAuthenticator("test", func(username string, password string) (*Principal, error) {
+		if username == "john" && password == "secret" {
+			return &Principal{Name: username}, nil
+		}
+		return nil, nil
+	})
+	bearer := NewBearerAuthenticator("test", func(token string) (*Principal, error) {
+		if token == "good" {
+			return &Principal{Name: "token"}, nil
+		}
+		return nil, errors.New("database error")
+	})
+	apiKey := NewApiKeyAuthenticator(func(key string) (*Principal, error) {
+		if key == "key1" {
+			return &Principal{Name: "key1"}, nil
+		}
+		return nil, nil
+	})
+	apiKey.QueryParam = "api_key"
+
+	var controller ControllerAuthTesters
+	app := NewApplication()
+	app.RegisterController("private", &controller)
+	app.RegisterController("public", &ControllerTesters{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.UseController("private", NewAuth(basic, bearer, apiKey).Handle)
+
+	type AuthTest struct {
+		url       string
+		header    string
+		value     string
+		status    int
+		principal string
+		challenge int
+	}
+	var authTests = []AuthTest{
+		{"/public", "", "", http.StatusOK, "", 0},
+		{"/private", "", "", http.StatusUnauthorized, "", 2},
+		{"/private", "Authorization", "Basic am9objpzZWNyZXQ=", http.StatusOK, "john", 0},
+		{"/private", "Authorization", "Basic am9objp3cm9uZw==", http.StatusUnauthorized, "", 2},
+		{"/private", "Authorization", "Bearer good", http.StatusOK, "token", 0},
+		{"/private", "Authorization", "Bearer bad", http.StatusUnauthorized, "", 2},
+		{"/private", "X-API-Key", "key1", http.StatusOK, "key1", 0},
+		{"/private?api_key=key1", "", "", http.StatusOK, "key1", 0},
+		{"/private?api_key=nope", "", "", http.StatusUnauthorized, "", 2},
+	}
+	for _, d := range authTests {
+		controller.Principal = nil
+		var reader io.Reader
+		request, _ := http.NewRequest("GET", d.url, reader)
+		if d.header != "" {
+			request.Header.Set(d.header, d.value)
+		}
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != d.status {
+			t.Errorf("%s %s: Expected %d, got %d", d.url, d.value, d.status, ctx.Response.Status)
+		}
+		if len(ctx.Response.Header["Www-Authenticate"]) != d.challenge {
+			t.Errorf("%s %s: Expected %d challenges, got %s", d.url, d.value, d.challenge, ctx.Response.Header["Www-Authenticate"])
+		}
+		name := ""
+		if controller.Principal != nil {
+			name = controller.Principal.Name
+		}
+		if name != d.principal {
+			t.Errorf("%s %s: Expected principal %s, got %s", d.url, d.value, d.principal, name)
+		}
+	}
+}
+
+func TestRouteGroup(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("users", &ControllerTesters{})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+
+	var calls []string
+	admin := app.Group("admin")
+	admin.AddRoute(Route{Pattern: ":_controller/:id"})
+	admin.Use(func(ctx *Context, next func()) {
+		calls = append(calls, "admin")
+		next()
+	})
+	super := admin.Group("super/")
+	super.Use(func(ctx *Context, next func()) {
+		calls = append(calls, "super")
+		next()
+	})
+	super.AddRoute(Route{Pattern: ":_controller/:id", Middlewares: []Middleware{func(ctx *Context, next func()) {
+		calls = append(calls, "route")
+		next()
+	}}})
+
+	type GroupTest struct {
+		url   string
+		calls string
+	}
+	var groupTests = []GroupTest{
+		{"/users/1", ""},
+		{"/admin/users/1", "admin"},
+		{"/admin/super/users/1", "admin,super,route"},
+	}
+	for _, d := range groupTests {
+		calls = nil
+		var reader io.Reader
+		request, _ := http.NewRequest("GET", d.url, reader)
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != http.StatusOK {
+			t.Errorf("%s: Expected %d, got %d", d.url, http.StatusOK, ctx.Response.Status)
+		}
+		output := strings.Join(calls, ",")
+		if output != d.calls {
+			t.Errorf("%s: Expected %s, got %s", d.url, d.calls, output)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package ripple
+
+import (
+	"log"
+	"net/http"
+	"reflect"
+)
+
+// The roles and scopes required to run an action.
+type Policy struct {
+	// The principal must have at least one of these roles.
+	Roles []string
+	// The principal must have all of these scopes.
+	Scopes []string
+}
+
+// Implemented by the controllers that restrict access to their actions. For
+// example:
+//
+//	func (this *UserController) Policies() map[string]ripple.Policy {
+//		return map[string]ripple.Policy{
+//			"*":           {Scopes: []string{"users:read"}},
+//			"PostFriends": {Scopes: []string{"users:write"}},
+//			"Delete":      {Roles: []string{"admin"}},
+//		}
+//	}
+//
+// The policies are enforced by the application, after the middlewares have
+// run and before calling the action. If there is no authenticated principal
+// (see Auth), the client receives a 401 Unauthorized response. If the
+// principal does not satisfy the policy, it receives a 403 Forbidden response.
+type PolicyProvider interface {
+	// Returns the policies indexed by method name, such as "Get" or
+	// "PostFriends". The policy with the "*" key applies to the actions
+	// that do not have a policy of their own.
+	Policies() map[string]Policy
+}
+
+// Tells whether the principal satisfies the policy.
+func (this *Policy) Allows(principal *Principal) bool {
+	if principal == nil {
+		return false
+	}
+	if len(this.Roles) > 0 {
+		found := false
+		for _, role := range this.Roles {
+			if principal.HasRole(role) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, scope := range this.Scopes {
+		if !principal.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *Application) registerPolicies(name string, controller interface{}) {
+	provider, ok := controller.(PolicyProvider)
+	if !ok {
+		delete(this.policies, name)
+		return
+	}
+	policies := provider.Policies()
+	controllerVal := reflect.ValueOf(controller)
+	for methodName := range policies {
+		if methodName != "*" && !controllerVal.MethodByName(methodName).IsValid() {
+			log.Panicf("\"%s\" controller has a policy for \"%s\" but no such method.\n", name, methodName)
+		}
+	}
+	this.policies[name] = policies
+}
+
+// Returns the policy of the given controller method, or nil if there is none.
+func (this *Application) actionPolicy(controllerName string, methodName string) *Policy {
+	policies, ok := this.policies[controllerName]
+	if !ok {
+		return nil
+	}
+	policy, ok := policies[methodName]
+	if !ok {
+		policy, ok = policies["*"]
+	}
+	if !ok {
+		return nil
+	}
+	return &policy
+}
+
+// Checks the policy and, if the principal does not satisfy it, sets the
+// error response.
+func (this *Application) authorize(ctx *Context, policy *Policy) bool {
+	if policy.Allows(ctx.Principal()) {
+		return true
+	}
+	if ctx.Principal() == nil {
+		ctx.Error(http.StatusUnauthorized, "")
+	} else {
+		ctx.Error(http.StatusForbidden, "")
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package ripple
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+type ControllerPolicyTesters struct{}
+
+func (this *ControllerPolicyTesters) Get(ctx *Context)         {}
+func (this *ControllerPolicyTesters) GetFriends(ctx *Context)  {}
+func (this *ControllerPolicyTesters) PostFriends(ctx *Context) {}
+func (this *ControllerPolicyTesters) Delete(ctx *Context)      {}
+
+func (this *ControllerPolicyTesters) Policies() map[string]Policy {
+	return map[string]Policy{
+		"*":           {Scopes: []string{"read"}},
+		"PostFriends": {Scopes: []string{"read", "write"}},
+		"Delete":      {Roles: []string{"admin", "owner"}},
+	}
+}
+
+type ControllerBadPolicyTesters struct{}
+
+func (this *ControllerBadPolicyTesters) Get(ctx *Context) {}
+
+func (this *ControllerBadPolicyTesters) Policies() map[string]Policy {
+	return map[string]Policy{"GetNothing": {Roles: []string{"admin"}}}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	policy := Policy{Roles: []string{"admin", "owner"}, Scopes: []string{"read", "write"}}
+	if policy.Allows(nil) {
+		t.Errorf("Policy should not allow nil principal")
+	}
+	if policy.Allows(&Principal{Roles: []string{"admin"}, Scopes: []string{"read"}}) {
+		t.Errorf("Policy should require all scopes")
+	}
+	if policy.Allows(&Principal{Roles: []string{"user"}, Scopes: []string{"read", "write"}}) {
+		t.Errorf("Policy should require one of the roles")
+	}
+	if !policy.Allows(&Principal{Roles: []string{"owner"}, Scopes: []string{"write", "read"}}) {
+		t.Errorf("Policy should allow principal")
+	}
+	empty := Policy{}
+	if !empty.Allows(&Principal{}) {
+		t.Errorf("Empty policy should allow any principal")
+	}
+}
+
+func TestPolicyEnforcement(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("users", &ControllerPolicyTesters{})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+
+	var principal *Principal
+	app.Use(func(ctx *Context, next func()) {
+		ctx.SetPrincipal(principal)
+		next()
+	})
+
+	reader := &Principal{Scopes: []string{"read"}}
+	writer := &Principal{Scopes: []string{"read", "write"}}
+	admin := &Principal{Roles: []string{"admin"}}
+
+	type PolicyTest struct {
+		method    string
+		url       string
+		principal *Principal
+		status    int
+	}
+	var policyTests = []PolicyTest{
+		{"GET", "/users/1", nil, http.StatusUnauthorized},
+		{"GET", "/users/1", reader, http.StatusOK},
+		{"GET", "/users/1/friends", reader, http.StatusOK},
+		{"GET", "/users/1", admin, http.StatusForbidden},
+		{"POST", "/users/1/friends", reader, http.StatusForbidden},
+		{"POST", "/users/1/friends", writer, http.StatusCreated},
+		{"DELETE", "/users/1", writer, http.StatusForbidden},
+		{"DELETE", "/users/1", admin, http.StatusOK},
+	}
+	for _, d := range policyTests {
+		principal = d.principal
+		var body io.Reader
+		request, _ := http.NewRequest(d.method, d.url, body)
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != d.status {
+			t.Errorf("%s %s: Expected %d, got %d", d.method, d.url, d.status, ctx.Response.Status)
+		}
+	}
+
+	var body io.Reader
+	request, _ := http.NewRequest("DELETE", "/users/1", body)
+	r := app.matchRequest(request)
+	if r.Policy == nil || len(r.Policy.Roles) != 2 {
+		t.Errorf("Policy not set on match result")
+	}
+}
+
+func TestRegisterControllerPolicyPanic(t *testing.T) {
+	app := NewApplication()
+	defer func() { recover() }()
+	app.RegisterController("bad", &ControllerBadPolicyTesters{})
+	t.Error("Registered policy for missing method but RegisterController did not panic.")
+}
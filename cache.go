@@ -0,0 +1,504 @@
+package ripple
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A response stored by ResponseCache.
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   string
+	// When the response was generated.
+	Created time.Time
+	// The response is fresh until this time.
+	Expires time.Time
+	// After expiring, the response can still be served until this time while
+	// it is being refreshed in the background.
+	StaleUntil time.Time
+	// Used to invalidate the response (see ResponseCache.InvalidatePath() and
+	// ResponseCache.InvalidateController()).
+	Tags []string
+}
+
+// Stores the responses of ResponseCache. NewMemoryResponseCacheStore() builds
+// an in-memory store.
+type ResponseCacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, response *CachedResponse)
+	// Deletes all the responses that have the given tag.
+	Invalidate(tag string)
+	// Deletes all the responses.
+	Clear()
+}
+
+// Implemented by the controllers that set how long the responses of their
+// actions are cached. For example:
+//
+//	func (this *UserController) CacheTTLs() map[string]time.Duration {
+//		return map[string]time.Duration{
+//			"*":          time.Minute,
+//			"GetFriends": 10 * time.Second,
+//			"GetSession": 0,
+//		}
+//	}
+type CacheProvider interface {
+	// Returns the TTLs indexed by method name. The TTL with the "*" key applies
+	// to the actions that do not have a TTL of their own. A TTL of zero
+	// disables caching.
+	CacheTTLs() map[string]time.Duration
+}
+
+type cacheRevalidateKey struct{}
+
+// A middleware that caches the responses of the GET actions on the server.
+// Use NewResponseCache() to build it:
+//
+//	cache := ripple.NewResponseCache()
+//	app.UseController("users", cache.Handle)
+//
+// The responses are cached by action, parameters, query string, principal
+// (see Auth) and the values of the request headers listed in VaryHeaders.
+// The Auth middleware must therefore run before this one. Only the 200 OK
+// responses are cached, and the policy of the action (see PolicyProvider) is
+// checked before serving them. The Cache-Control header of the requests and
+// responses is honoured: for example, a request with "no-cache" bypasses the
+// cache, and a response with "private" or "no-store" is not stored. If the
+// action does not set a Cache-Control header, one is added based on the TTL,
+// which is private if the request is authenticated. The headers that only
+// apply to the current request, such as the CORS, rate limit and Set-Cookie
+// headers, are not stored, and a cached response never overwrites the
+// headers already set by the middlewares.
+//
+// After modifying a resource, a controller can invalidate the cached
+// responses with InvalidatePath() or InvalidateController().
+type ResponseCache struct {
+	// How long the responses are cached, unless the controller implements
+	// CacheProvider or the response has a max-age directive (default to one
+	// minute).
+	TTL time.Duration
+	// How long an expired response can still be served, while a fresh one is
+	// generated in the background (default to zero, which disables it).
+	StaleWhileRevalidate time.Duration
+	// The request headers whose values are part of the cache key, such as
+	// "Accept-Language". Requests with an Authorization header are not cached,
+	// unless "Authorization" is in this list.
+	VaryHeaders []string
+	Store       ResponseCacheStore
+
+	mutex        sync.Mutex
+	revalidating map[string]bool
+	now          func() time.Time
+}
+
+// Build a new response cache with an in-memory store of at most 10,000
+// responses and 64 MB.
+func NewResponseCache() *ResponseCache {
+	output := new(ResponseCache)
+	output.TTL = time.Minute
+	output.Store = NewMemoryResponseCacheStore(10000, 64*1024*1024)
+	output.revalidating = make(map[string]bool)
+	output.now = time.Now
+	return output
+}
+
+// Deletes the cached responses of the given request path, such as "/users/1".
+func (this *ResponseCache) InvalidatePath(path string) {
+	this.Store.Invalidate("path:" + path)
+}
+
+// Deletes all the cached responses of the given controller.
+func (this *ResponseCache) InvalidateController(name string) {
+	this.Store.Invalidate("controller:" + name)
+}
+
+// Implementation of Middleware.
+func (this *ResponseCache) Handle(ctx *Context, next func()) {
+	match := ctx.Match()
+	if ctx.Request.Method != "GET" || !match.Success {
+		next()
+		return
+	}
+	ttl := this.actionTTL(match, ctx.Request.Method)
+	if ttl <= 0 || (ctx.Request.Header.Get("Authorization") != "" && !this.varies("Authorization")) {
+		next()
+		return
+	}
+	// The policy of the action is normally enforced after the middlewares,
+	// so it must be checked before serving a cached response. The action is
+	// not run either way, but the application sets the error response.
+	if match.Policy != nil && !match.Policy.Allows(ctx.Principal()) {
+		next()
+		return
+	}
+
+	directives := parseCacheControl(ctx.Request.Header.Get("Cache-Control"))
+	key := this.cacheKey(ctx)
+	_, revalidating := ctx.Value(cacheRevalidateKey{}).(bool)
+	_, noCache := directives["no-cache"]
+	_, noStore := directives["no-store"]
+
+	if !revalidating && !noCache && !noStore {
+		if cached, ok := this.Store.Get(key); ok {
+			now := this.now()
+			age := now.Sub(cached.Created)
+			maxAge, hasMaxAge := cacheControlSeconds(directives, "max-age")
+			if now.Before(cached.Expires) && (!hasMaxAge || age <= maxAge) {
+				this.serve(ctx, cached, age, "HIT")
+				return
+			}
+			if now.Before(cached.StaleUntil) && !hasMaxAge {
+				this.serve(ctx, cached, age, "STALE")
+				this.revalidate(ctx, key)
+				return
+			}
+		}
+	}
+
+	next()
+
+	ctx.Response.Header.Set("X-Cache", "MISS")
+	if !noStore {
+		this.save(ctx, key, ttl)
+	}
+}
+
+// Returns the TTL of the matched action.
+func (this *ResponseCache) actionTTL(match MatchRequestResult, requestMethod string) time.Duration {
+	provider, ok := match.ControllerValue.Interface().(CacheProvider)
+	if !ok {
+		return this.TTL
+	}
+	ttls := provider.CacheTTLs()
+	if ttl, ok := ttls[makeMethodName(requestMethod, match.ActionName)]; ok {
+		return ttl
+	}
+	if ttl, ok := ttls["*"]; ok {
+		return ttl
+	}
+	return this.TTL
+}
+
+func (this *ResponseCache) varies(name string) bool {
+	for _, header := range this.VaryHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *ResponseCache) cacheKey(ctx *Context) string {
+	match := ctx.Match()
+	params := url.Values{}
+	for name, value := range match.Params {
+		params.Set(name, value)
+	}
+	output := match.ControllerName + " " + match.ActionName + "\n" + params.Encode() + "\n" + ctx.Request.URL.Query().Encode()
+	for _, header := range this.VaryHeaders {
+		output += "\n" + strings.Join(ctx.Request.Header.Values(header), ",")
+	}
+	// The response may depend on the principal, however it was authenticated.
+	if ctx.Principal() != nil {
+		output += "\nprincipal:" + ctx.Principal().Name
+	}
+	return output
+}
+
+func (this *ResponseCache) serve(ctx *Context, cached *CachedResponse, age time.Duration, status string) {
+	replayHeader(ctx.Response.Header, cached.Header)
+	ctx.Response.Header.Set("Age", strconv.Itoa(int(age/time.Second)))
+	ctx.Response.Header.Set("X-Cache", status)
+	ctx.Response.Status = cached.Status
+	ctx.Response.Body = cached.Body
+}
+
+// Generates a fresh response in the background, unless it is already being
+// generated.
+func (this *ResponseCache) revalidate(ctx *Context, key string) {
+	app := ctx.Application()
+	if app == nil {
+		return
+	}
+	this.mutex.Lock()
+	if this.revalidating[key] {
+		this.mutex.Unlock()
+		return
+	}
+	this.revalidating[key] = true
+	this.mutex.Unlock()
+
+	request := ctx.Request.Clone(context.WithValue(context.Background(), cacheRevalidateKey{}, true))
+	requestId := ctx.RequestID()
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[%s] Could not revalidate cached response: %v\n", requestId, r)
+			}
+			this.mutex.Lock()
+			delete(this.revalidating, key)
+			this.mutex.Unlock()
+		}()
+		app.Dispatch(request)
+	}()
+}
+
+func (this *ResponseCache) save(ctx *Context, key string, ttl time.Duration) {
+	if ctx.Response.Status != http.StatusOK || ctx.Application() == nil {
+		return
+	}
+	if _, ok := ctx.Response.Body.(io.Reader); ok {
+		return
+	}
+
+	header := ctx.Response.Header
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[name]; ok {
+			return
+		}
+	}
+	if seconds, ok := cacheControlSeconds(directives, "s-maxage"); ok {
+		ttl = seconds
+	} else if seconds, ok := cacheControlSeconds(directives, "max-age"); ok {
+		ttl = seconds
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	body, err := ctx.Application().serializeResponseBody(ctx.Response.Body)
+	if err != nil {
+		return
+	}
+
+	if header.Get("Cache-Control") == "" {
+		// Shared caches must not serve the response of a client to other
+		// clients, however it has been authenticated.
+		cacheControl := "public"
+		if this.varies("Authorization") || hasCredentials(ctx) {
+			cacheControl = "private"
+		}
+		cacheControl += ", max-age=" + strconv.Itoa(int(ttl/time.Second))
+		if this.StaleWhileRevalidate > 0 {
+			cacheControl += ", stale-while-revalidate=" + strconv.Itoa(int(this.StaleWhileRevalidate/time.Second))
+		}
+		header.Set("Cache-Control", cacheControl)
+	}
+	for _, name := range this.VaryHeaders {
+		header.Add("Vary", name)
+	}
+
+	now := this.now()
+	cached := new(CachedResponse)
+	cached.Status = ctx.Response.Status
+	cached.Header = storableHeader(header, ctx.Application().RequestIDHeader())
+	cached.Header.Del("X-Cache")
+	cached.Body = body
+	cached.Created = now
+	cached.Expires = now.Add(ttl)
+	cached.StaleUntil = cached.Expires.Add(this.StaleWhileRevalidate)
+	cached.Tags = []string{"controller:" + ctx.Match().ControllerName, "path:" + ctx.Request.URL.Path}
+	this.Store.Set(key, cached)
+}
+
+// Tells whether the request is authenticated, or carries credentials that
+// may have been used to build the response.
+func hasCredentials(ctx *Context) bool {
+	return ctx.Principal() != nil || ctx.Request.Header.Get("Authorization") != "" || ctx.Request.Header.Get("Cookie") != ""
+}
+
+// Returns a copy of the response headers without those that only apply to
+// the current request, such as the request ID, CORS, rate limit and cookie
+// headers, so that the response can be stored and replayed to other requests.
+func storableHeader(header http.Header, requestIdHeader string) http.Header {
+	output := header.Clone()
+	output.Del(requestIdHeader)
+	for name := range output {
+		lowerName := strings.ToLower(name)
+		if strings.HasPrefix(lowerName, "access-control-") || strings.HasPrefix(lowerName, "ratelimit-") || strings.HasPrefix(lowerName, "x-ratelimit-") || lowerName == "retry-after" || lowerName == "set-cookie" {
+			delete(output, name)
+		}
+	}
+	return output
+}
+
+// Copies the stored headers to the response, without overwriting the headers
+// already set for the current request. The Vary values are merged.
+func replayHeader(header http.Header, stored http.Header) {
+	for name, values := range stored {
+		if name == "Vary" {
+			for _, value := range values {
+				if !containsString(header.Values("Vary"), value) {
+					header.Add("Vary", value)
+				}
+			}
+			continue
+		}
+		if _, ok := header[name]; ok {
+			continue
+		}
+		header[name] = append([]string(nil), values...)
+	}
+}
+
+// Parses a Cache-Control header into a map of directives. The directives
+// without value are mapped to an empty string.
+func parseCacheControl(value string) map[string]string {
+	output := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name := part
+		argument := ""
+		if index := strings.Index(part, "="); index >= 0 {
+			name = part[0:index]
+			argument = strings.Trim(part[index+1:], "\"")
+		}
+		output[strings.ToLower(strings.TrimSpace(name))] = argument
+	}
+	return output
+}
+
+// Returns the duration of a directive such as "max-age=60".
+func cacheControlSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+type memoryResponseCacheEntry struct {
+	key      string
+	response *CachedResponse
+	size     int
+}
+
+// An in-memory ResponseCacheStore. When it is full, the least recently used
+// responses are removed.
+type MemoryResponseCacheStore struct {
+	mutex      sync.Mutex
+	maxEntries int
+	maxSize    int
+	size       int
+	entries    map[string]*list.Element
+	order      *list.List
+	tags       map[string]map[string]bool
+}
+
+// Build a new in-memory store that holds at most maxEntries responses and
+// maxSize bytes. Either limit can be zero for no limit.
+func NewMemoryResponseCacheStore(maxEntries int, maxSize int) *MemoryResponseCacheStore {
+	output := new(MemoryResponseCacheStore)
+	output.maxEntries = maxEntries
+	output.maxSize = maxSize
+	output.entries = make(map[string]*list.Element)
+	output.order = list.New()
+	output.tags = make(map[string]map[string]bool)
+	return output
+}
+
+// Implementation of ResponseCacheStore.
+func (this *MemoryResponseCacheStore) Get(key string) (*CachedResponse, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	element, ok := this.entries[key]
+	if !ok {
+		return nil, false
+	}
+	this.order.MoveToFront(element)
+	return element.Value.(*memoryResponseCacheEntry).response, true
+}
+
+// Implementation of ResponseCacheStore.
+func (this *MemoryResponseCacheStore) Set(key string, response *CachedResponse) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	entry := new(memoryResponseCacheEntry)
+	entry.key = key
+	entry.response = response
+	entry.size = len(key) + len(response.Body)
+	for name, values := range response.Header {
+		entry.size += len(name)
+		for _, value := range values {
+			entry.size += len(value)
+		}
+	}
+	if this.maxSize > 0 && entry.size > this.maxSize {
+		return
+	}
+
+	if element, ok := this.entries[key]; ok {
+		this.remove(element)
+	}
+	this.entries[key] = this.order.PushFront(entry)
+	this.size += entry.size
+	for _, tag := range response.Tags {
+		if this.tags[tag] == nil {
+			this.tags[tag] = make(map[string]bool)
+		}
+		this.tags[tag][key] = true
+	}
+
+	for (this.maxEntries > 0 && this.order.Len() > this.maxEntries) || (this.maxSize > 0 && this.size > this.maxSize) {
+		this.remove(this.order.Back())
+	}
+}
+
+// Implementation of ResponseCacheStore.
+func (this *MemoryResponseCacheStore) Invalidate(tag string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for key := range this.tags[tag] {
+		if element, ok := this.entries[key]; ok {
+			this.remove(element)
+		}
+	}
+}
+
+// Implementation of ResponseCacheStore.
+func (this *MemoryResponseCacheStore) Clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.entries = make(map[string]*list.Element)
+	this.order.Init()
+	this.tags = make(map[string]map[string]bool)
+	this.size = 0
+}
+
+// Returns the number of responses in the store.
+func (this *MemoryResponseCacheStore) Len() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.order.Len()
+}
+
+func (this *MemoryResponseCacheStore) remove(element *list.Element) {
+	entry := element.Value.(*memoryResponseCacheEntry)
+	this.order.Remove(element)
+	delete(this.entries, entry.key)
+	this.size -= entry.size
+	for _, tag := range entry.response.Tags {
+		delete(this.tags[tag], entry.key)
+		if len(this.tags[tag]) == 0 {
+			delete(this.tags, tag)
+		}
+	}
+}
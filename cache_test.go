@@ -0,0 +1,385 @@
+package ripple
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type ControllerCacheTester struct {
+	calls        int32
+	cacheControl string
+}
+
+func (this *ControllerCacheTester) Get(ctx *Context) {
+	n := atomic.AddInt32(&this.calls, 1)
+	if this.cacheControl != "" {
+		ctx.Response.Header.Set("Cache-Control", this.cacheControl)
+	}
+	ctx.Response.Body = map[string]interface{}{"id": ctx.Params["id"], "n": n}
+}
+
+func (this *ControllerCacheTester) GetFriends(ctx *Context) {
+	atomic.AddInt32(&this.calls, 1)
+	ctx.Response.Body = "friends"
+}
+
+func (this *ControllerCacheTester) CacheTTLs() map[string]time.Duration {
+	return map[string]time.Duration{
+		"*":          time.Minute,
+		"GetFriends": 0,
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	cache := NewResponseCache()
+	cache.VaryHeaders = []string{"Accept-Language"}
+	cache.now = func() time.Time { return now }
+
+	app := NewApplication()
+	controller := &ControllerCacheTester{}
+	app.RegisterController("users", controller)
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+	app.UseController("users", cache.Handle)
+
+	dispatch := func(url string, headers map[string]string) *Context {
+		request, _ := http.NewRequest("GET", url, nil)
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		return app.Dispatch(request)
+	}
+
+	type testCase struct {
+		url           string
+		headers       map[string]string
+		expectedCalls int32
+		expectedCache string
+	}
+
+	testCases := []testCase{
+		{"/users/1", nil, 1, "MISS"},
+		{"/users/1", nil, 1, "HIT"},
+		{"/users/1?b=2&a=1", nil, 2, "MISS"},
+		{"/users/1?a=1&b=2", nil, 2, "HIT"},
+		{"/users/2", nil, 3, "MISS"},
+		{"/users/1", map[string]string{"Accept-Language": "fr"}, 4, "MISS"},
+		{"/users/1", map[string]string{"Cache-Control": "no-cache"}, 5, "MISS"},
+		{"/users/1", map[string]string{"Authorization": "Bearer abc"}, 6, ""},
+		{"/users/1/friends", nil, 7, ""},
+		{"/users/1/friends", nil, 8, ""},
+	}
+
+	for i, d := range testCases {
+		ctx := dispatch(d.url, d.headers)
+		if controller.calls != d.expectedCalls {
+			t.Errorf("Test %d: Expected %d calls, got %d", i, d.expectedCalls, controller.calls)
+		}
+		if ctx.Response.Header.Get("X-Cache") != d.expectedCache {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.expectedCache, ctx.Response.Header.Get("X-Cache"))
+		}
+		if ctx.Response.Status != http.StatusOK {
+			t.Errorf("Test %d: Expected %d, got %d", i, http.StatusOK, ctx.Response.Status)
+		}
+	}
+
+	ctx := dispatch("/users/1", nil)
+	if ctx.Response.Header.Get("Cache-Control") != "public, max-age=60" {
+		t.Errorf("Expected %s, got %s", "public, max-age=60", ctx.Response.Header.Get("Cache-Control"))
+	}
+	if ctx.Response.Header.Get("Vary") != "Accept-Language" {
+		t.Errorf("Expected %s, got %s", "Accept-Language", ctx.Response.Header.Get("Vary"))
+	}
+
+	now = now.Add(30 * time.Second)
+	ctx = dispatch("/users/1", nil)
+	if ctx.Response.Header.Get("Age") != "30" {
+		t.Errorf("Expected %s, got %s", "30", ctx.Response.Header.Get("Age"))
+	}
+	ctx = dispatch("/users/1", map[string]string{"Cache-Control": "max-age=10"})
+	if ctx.Response.Header.Get("X-Cache") != "MISS" {
+		t.Errorf("Expected %s, got %s", "MISS", ctx.Response.Header.Get("X-Cache"))
+	}
+
+	calls := controller.calls
+	cache.InvalidatePath("/users/1")
+	dispatch("/users/1", nil)
+	dispatch("/users/2", nil)
+	if controller.calls != calls+1 {
+		t.Errorf("Expected %d, got %d", calls+1, controller.calls)
+	}
+
+	cache.InvalidateController("users")
+	dispatch("/users/2", nil)
+	if controller.calls != calls+2 {
+		t.Errorf("Expected %d, got %d", calls+2, controller.calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	ctx = dispatch("/users/2", nil)
+	if controller.calls != calls+3 || ctx.Response.Header.Get("X-Cache") != "MISS" {
+		t.Errorf("Expected expired response to be regenerated")
+	}
+}
+
+func TestResponseCacheControl(t *testing.T) {
+	cache := NewResponseCache()
+	app := NewApplication()
+	controller := &ControllerCacheTester{}
+	app.RegisterController("users", controller)
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+	app.UseController("users", cache.Handle)
+
+	type testCase struct {
+		cacheControl  string
+		expectedCalls int32
+	}
+
+	testCases := []testCase{
+		{"private, max-age=60", 2},
+		{"no-store", 2},
+		{"max-age=0", 2},
+		{"max-age=60", 1},
+	}
+
+	for i, d := range testCases {
+		controller.calls = 0
+		controller.cacheControl = d.cacheControl
+		cache.Store.Clear()
+		for j := 0; j < 2; j++ {
+			request, _ := http.NewRequest("GET", "/users/1", nil)
+			app.Dispatch(request)
+		}
+		if controller.calls != d.expectedCalls {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.expectedCalls, controller.calls)
+		}
+	}
+}
+
+type notifyingResponseCacheStore struct {
+	ResponseCacheStore
+	saved chan bool
+}
+
+func (this *notifyingResponseCacheStore) Set(key string, response *CachedResponse) {
+	this.ResponseCacheStore.Set(key, response)
+	this.saved <- true
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	var now atomic.Value
+	now.Store(time.Unix(1500000000, 0))
+	cache := NewResponseCache()
+	cache.StaleWhileRevalidate = time.Minute
+	cache.now = func() time.Time { return now.Load().(time.Time) }
+	store := &notifyingResponseCacheStore{cache.Store, make(chan bool, 1)}
+	cache.Store = store
+
+	app := NewApplication()
+	controller := &ControllerCacheTester{}
+	app.RegisterController("users", controller)
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+	app.UseController("users", cache.Handle)
+
+	dispatch := func() *Context {
+		request, _ := http.NewRequest("GET", "/users/1", nil)
+		return app.Dispatch(request)
+	}
+
+	ctx := dispatch()
+	<-store.saved
+	if ctx.Response.Header.Get("Cache-Control") != "public, max-age=60, stale-while-revalidate=60" {
+		t.Errorf("Expected %s, got %s", "public, max-age=60, stale-while-revalidate=60", ctx.Response.Header.Get("Cache-Control"))
+	}
+
+	now.Store(now.Load().(time.Time).Add(90 * time.Second))
+	ctx = dispatch()
+	if ctx.Response.Header.Get("X-Cache") != "STALE" {
+		t.Errorf("Expected %s, got %s", "STALE", ctx.Response.Header.Get("X-Cache"))
+	}
+
+	// Waits for the response fetched in the background to be saved.
+	<-store.saved
+	ctx = dispatch()
+	if ctx.Response.Header.Get("X-Cache") != "HIT" {
+		t.Errorf("Expected %s, got %s", "HIT", ctx.Response.Header.Get("X-Cache"))
+	}
+	expected := "{\"id\":\"1\",\"n\":2}"
+	if ctx.Response.Body != expected {
+		t.Errorf("Expected %s, got %s", expected, ctx.Response.Body)
+	}
+}
+
+func TestMemoryResponseCacheStore(t *testing.T) {
+	store := NewMemoryResponseCacheStore(3, 0)
+	for i := 0; i < 3; i++ {
+		store.Set(strconv.Itoa(i), &CachedResponse{Body: "x", Tags: []string{"t" + strconv.Itoa(i%2)}})
+	}
+	store.Get("0")
+	store.Set("3", &CachedResponse{Body: "x"})
+	if _, ok := store.Get("1"); ok {
+		t.Errorf("Expected least recently used entry to be evicted")
+	}
+	if _, ok := store.Get("0"); !ok {
+		t.Errorf("Expected recently used entry to be kept")
+	}
+
+	store.Invalidate("t0")
+	if store.Len() != 1 {
+		t.Errorf("Expected %d, got %d", 1, store.Len())
+	}
+
+	store = NewMemoryResponseCacheStore(0, 8)
+	store.Set("a", &CachedResponse{Body: "1234"})
+	store.Set("b", &CachedResponse{Body: "1234"})
+	if store.Len() != 1 {
+		t.Errorf("Expected %d, got %d", 1, store.Len())
+	}
+	store.Set("c", &CachedResponse{Body: "12345678"})
+	if _, ok := store.Get("c"); ok {
+		t.Errorf("Expected oversized entry to be rejected")
+	}
+}
+
+type ControllerCachePolicyTester struct {
+	calls int32
+}
+
+func (this *ControllerCachePolicyTester) Get(ctx *Context) {
+	atomic.AddInt32(&this.calls, 1)
+	ctx.Response.Body = "secret of " + ctx.Principal().Name
+}
+
+func (this *ControllerCachePolicyTester) GetPublic(ctx *Context) {
+	atomic.AddInt32(&this.calls, 1)
+	name := ""
+	if ctx.Principal() != nil {
+		name = ctx.Principal().Name
+	}
+	ctx.Response.Body = "hello " + name
+}
+
+func (this *ControllerCachePolicyTester) Policies() map[string]Policy {
+	return map[string]Policy{
+		"Get": {Roles: []string{"admin"}},
+	}
+}
+
+func TestResponseCacheAuth(t *testing.T) {
+	apiKey := NewApiKeyAuthenticator(func(key string) (*Principal, error) {
+		if key == "admin" || key == "guest" {
+			return &Principal{Name: key, Roles: []string{key}}, nil
+		}
+		return nil, nil
+	})
+
+	app := NewApplication()
+	controller := &ControllerCachePolicyTester{}
+	app.RegisterController("secrets", controller)
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:_action"})
+	app.UseController("secrets", NewAuth(apiKey).Handle)
+	app.UseController("secrets", NewResponseCache().Handle)
+
+	type testCase struct {
+		url           string
+		apiKey        string
+		status        int
+		body          string
+		expectedCalls int32
+		expectedCache string
+	}
+
+	testCases := []testCase{
+		{"/secrets", "admin", http.StatusOK, "secret of admin", 1, "MISS"},
+		{"/secrets", "admin", http.StatusOK, "secret of admin", 1, "HIT"},
+		{"/secrets", "guest", http.StatusForbidden, "", 1, ""},
+		{"/secrets/public", "admin", http.StatusOK, "hello admin", 2, "MISS"},
+		{"/secrets/public", "guest", http.StatusOK, "hello guest", 3, "MISS"},
+		{"/secrets/public", "guest", http.StatusOK, "hello guest", 3, "HIT"},
+	}
+
+	for i, d := range testCases {
+		request, _ := http.NewRequest("GET", d.url, nil)
+		request.Header.Set("X-API-Key", d.apiKey)
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != d.status {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.status, ctx.Response.Status)
+		}
+		if d.body != "" && ctx.Response.Body != d.body {
+			t.Errorf("Test %d: Expected %s, got %v", i, d.body, ctx.Response.Body)
+		}
+		if controller.calls != d.expectedCalls {
+			t.Errorf("Test %d: Expected %d calls, got %d", i, d.expectedCalls, controller.calls)
+		}
+		if ctx.Response.Header.Get("X-Cache") != d.expectedCache {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.expectedCache, ctx.Response.Header.Get("X-Cache"))
+		}
+		if d.status == http.StatusOK && ctx.Response.Header.Get("Cache-Control") != "private, max-age=60" {
+			t.Errorf("Test %d: Expected %s, got %s", i, "private, max-age=60", ctx.Response.Header.Get("Cache-Control"))
+		}
+	}
+}
+
+type ControllerCacheHeaderTester struct {
+	calls int32
+}
+
+func (this *ControllerCacheHeaderTester) Get(ctx *Context) {
+	n := atomic.AddInt32(&this.calls, 1)
+	ctx.Response.Header.Set("Set-Cookie", "session="+strconv.Itoa(int(n)))
+	ctx.Response.Header.Set("X-Version", strconv.Itoa(int(n)))
+	ctx.Response.Body = "hello"
+}
+
+func TestResponseCacheHeaders(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("pages", &ControllerCacheHeaderTester{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.UseController("pages", func(ctx *Context, next func()) {
+		ctx.Response.Header.Set("Access-Control-Allow-Origin", ctx.Request.Header.Get("Origin"))
+		ctx.Response.Header.Set("RateLimit-Remaining", ctx.Request.Header.Get("X-Remaining"))
+		ctx.Response.Header.Add("Vary", "Origin")
+		next()
+	})
+	app.UseController("pages", NewResponseCache().Handle)
+
+	type testCase struct {
+		origin    string
+		remaining string
+		cache     string
+		cookie    string
+	}
+
+	testCases := []testCase{
+		{"https://a.example", "9", "MISS", "session=1"},
+		{"https://b.example", "8", "HIT", ""},
+	}
+
+	for i, d := range testCases {
+		request, _ := http.NewRequest("GET", "/pages", nil)
+		request.Header.Set("Origin", d.origin)
+		request.Header.Set("X-Remaining", d.remaining)
+		header := app.Dispatch(request).Response.Header
+		expected := map[string]string{
+			"X-Cache":                     d.cache,
+			"Access-Control-Allow-Origin": d.origin,
+			"Ratelimit-Remaining":         d.remaining,
+			"Set-Cookie":                  d.cookie,
+			"X-Version":                   "1",
+			"Cache-Control":               "public, max-age=60",
+		}
+		for name, value := range expected {
+			if header.Get(name) != value {
+				t.Errorf("Test %d: Expected %s: %s, got %s", i, name, value, header.Get(name))
+			}
+		}
+		if len(header.Values("Vary")) != 1 {
+			t.Errorf("Test %d: Expected %v, got %v", i, []string{"Origin"}, header.Values("Vary"))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Prints the route table of a Ripple application, as returned by
+// Application.Routes(). The application must be built by an exported function
+// of a non-main package, which takes no parameter and returns a
+// *ripple.Application:
+//
+//	package api
+//
+//	func NewApplication() *ripple.Application {
+//		app := ripple.NewApplication()
+//		app.RegisterController("users", NewUserController())
+//		app.AddRoute(ripple.Route{Pattern: ":_controller/:id/:_action"})
+//		return app
+//	}
+//
+// Then, from the module that contains the package:
+//
+//	ripple-routes -func NewApplication example.com/myapp/api
+//
+// The command generates a small program that calls the function, and runs it
+// with "go run".
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const programTemplate = `package main
+
+import (
+	"os"
+
+	app %q
+)
+
+func main() {
+	err := app.%s().WriteRoutes(os.Stdout)
+	if err != nil {
+		panic(err)
+	}
+}
+`
+
+func main() {
+	funcName := flag.String("func", "NewApplication", "the function that returns the *ripple.Application")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ripple-routes [-func name] <package>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !token.IsIdentifier(*funcName) || !token.IsExported(*funcName) {
+		fmt.Fprintf(os.Stderr, "Invalid function name: %s\n", *funcName)
+		os.Exit(2)
+	}
+
+	err := run(flag.Arg(0), *funcName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(packagePath string, funcName string) error {
+	// The program is generated in the current directory so that the package
+	// is resolved from the current module.
+	dir, err := os.MkdirTemp(".", ".ripple-routes-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	program := fmt.Sprintf(programTemplate, packagePath, funcName)
+	err = os.WriteFile(filepath.Join(dir, "main.go"), []byte(program), 0644)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("go", "run", "./"+filepath.Base(dir))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,187 @@
+package ripple
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compresses the response bodies with gzip or deflate, depending on the
+// Accept-Encoding header of the request. Use NewCompression() to build it,
+// then enable it with Application.SetCompression().
+type Compression struct {
+	// The bodies smaller than this size (in bytes) are not compressed. Streamed
+	// bodies, whose size is unknown, are always compressed.
+	MinSize int
+	// The compression level, from flate.BestSpeed to flate.BestCompression
+	// (default to flate.DefaultCompression).
+	Level int
+	// The media types that are not compressed, usually because they are
+	// already compressed. A type can end with "/*" to match a whole family,
+	// such as "video/*".
+	SkippedTypes []string
+}
+
+// Build a new compression object.
+func NewCompression() *Compression {
+	output := new(Compression)
+	output.MinSize = 1024
+	output.Level = flate.DefaultCompression
+	output.SkippedTypes = []string{
+		"image/png",
+		"image/jpeg",
+		"image/gif",
+		"image/webp",
+		"image/avif",
+		"video/*",
+		"audio/*",
+		"font/woff",
+		"font/woff2",
+		"application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/zstd",
+		"application/x-7z-compressed",
+		"application/x-rar-compressed",
+	}
+	return output
+}
+
+// Enables the compression of the response bodies. By default, compression is
+// disabled. Set to nil to disable it again.
+func (this *Application) SetCompression(v *Compression) {
+	this.compression = v
+}
+
+// Returns the compression settings, or nil if compression is disabled.
+func (this *Application) Compression() *Compression {
+	return this.compression
+}
+
+// Tells whether the given media type is compressible.
+func (this *Compression) isCompressible(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, skipped := range this.SkippedTypes {
+		if strings.HasSuffix(skipped, "/*") {
+			if strings.HasPrefix(mediaType, skipped[0:len(skipped)-1]) {
+				return false
+			}
+		} else if mediaType == skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// Sets the response headers and returns the writer that compresses the body,
+// or nil if the body should not be compressed. Must be called before the
+// header is written.
+func (this *Compression) start(writter http.ResponseWriter, request *http.Request, status int, size int) *compressWriter {
+	header := writter.Header()
+	if request.Method == "HEAD" || status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		return nil
+	}
+	if header.Get("Content-Encoding") != "" || !this.isCompressible(header.Get("Content-Type")) {
+		return nil
+	}
+
+	header.Add("Vary", "Accept-Encoding")
+	if size >= 0 && size < this.MinSize {
+		return nil
+	}
+
+	encoding := negotiateEncoding(request.Header.Get("Accept-Encoding"), []string{"gzip", "deflate"})
+	if encoding == "" {
+		return nil
+	}
+
+	output := new(compressWriter)
+	output.writter = writter
+	var err error
+	if encoding == "gzip" {
+		output.compressor, err = gzip.NewWriterLevel(writter, this.Level)
+	} else {
+		output.compressor, err = flate.NewWriter(writter, this.Level)
+	}
+	if err != nil {
+		return nil
+	}
+	header.Set("Content-Encoding", encoding)
+	header.Del("Content-Length")
+	// The compressed body is not byte-for-byte identical to the original one,
+	// so a strong ETag gets the encoding as suffix. It remains strong, so that
+	// the client can still use it in an If-Match header.
+	etag := header.Get("ETag")
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", encodedETag(etag, encoding))
+	}
+	return output
+}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type compressWriter struct {
+	writter    http.ResponseWriter
+	compressor compressor
+}
+
+func (this *compressWriter) Write(b []byte) (int, error) {
+	return this.compressor.Write(b)
+}
+
+// Sends the data compressed so far to the client.
+func (this *compressWriter) Flush() {
+	this.compressor.Flush()
+	if flusher, ok := this.writter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (this *compressWriter) Close() error {
+	return this.compressor.Close()
+}
+
+// Returns the supported encoding with the highest q-value in the
+// Accept-Encoding header, or an empty string if none is acceptable.
+// On equal q-values, the first supported encoding wins.
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	qValues := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					q = v
+				}
+			}
+		}
+		qValues[name] = q
+	}
+
+	output := ""
+	best := 0.0
+	for _, encoding := range supported {
+		q, ok := qValues[encoding]
+		if !ok {
+			q, ok = qValues["*"]
+		}
+		if ok && q > best {
+			output = encoding
+			best = q
+		}
+	}
+	return output
+}
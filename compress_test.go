@@ -0,0 +1,143 @@
+package ripple
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	type NegotiateTest struct {
+		acceptEncoding string
+		expected       string
+	}
+	var negotiateTests = []NegotiateTest{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip, deflate, br", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate;q=0.8", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"*", "gzip"},
+		{"*;q=0.5, gzip;q=0", "deflate"},
+		{"br, identity", ""},
+	}
+	for _, d := range negotiateTests {
+		output := negotiateEncoding(d.acceptEncoding, []string{"gzip", "deflate"})
+		if output != d.expected {
+			t.Errorf("%s: Expected %s, got %s", d.acceptEncoding, d.expected, output)
+		}
+	}
+}
+
+type ControllerCompressTesters struct{}
+
+func (this *ControllerCompressTesters) Get(ctx *Context) {
+	ctx.Response.Body = strings.Repeat("abcdef", 1000)
+}
+
+func (this *ControllerCompressTesters) GetSmall(ctx *Context) {
+	ctx.Response.Body = "small"
+}
+
+func (this *ControllerCompressTesters) GetImage(ctx *Context) {
+	ctx.Response.Header.Set("Content-Type", "image/png")
+	ctx.Response.Body = strings.Repeat("abcdef", 1000)
+}
+
+func (this *ControllerCompressTesters) GetStream(ctx *Context) {
+	ctx.Response.Body = io.NopCloser(strings.NewReader("streamed"))
+}
+
+func TestCompression(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("testers", &ControllerCompressTesters{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:_action"})
+	app.SetCompression(NewCompression())
+
+	type CompressionTest struct {
+		url            string
+		acceptEncoding string
+		encoding       string
+		vary           bool
+		body           string
+	}
+	var compressionTests = []CompressionTest{
+		{"/testers", "gzip", "gzip", true, strings.Repeat("abcdef", 1000)},
+		{"/testers", "deflate", "deflate", true, strings.Repeat("abcdef", 1000)},
+		{"/testers", "", "", true, strings.Repeat("abcdef", 1000)},
+		{"/testers/small", "gzip", "", true, "small"},
+		{"/testers/image", "gzip", "", false, strings.Repeat("abcdef", 1000)},
+		{"/testers/stream", "gzip", "gzip", true, "streamed"},
+		{"/testers/stream", "", "", true, "streamed"},
+	}
+	for _, d := range compressionTests {
+		var reader io.Reader
+		request, _ := http.NewRequest("GET", d.url, reader)
+		request.Header.Set("Accept-Encoding", d.acceptEncoding)
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, request)
+
+		encoding := recorder.Header().Get("Content-Encoding")
+		if encoding != d.encoding {
+			t.Errorf("%s %s: Expected encoding '%s', got '%s'", d.url, d.acceptEncoding, d.encoding, encoding)
+		}
+		vary := recorder.Header().Get("Vary") == "Accept-Encoding"
+		if vary != d.vary {
+			t.Errorf("%s %s: Expected Vary %t, got %t", d.url, d.acceptEncoding, d.vary, vary)
+		}
+
+		var bodyReader io.Reader = recorder.Body
+		if encoding == "gzip" {
+			bodyReader, _ = gzip.NewReader(recorder.Body)
+		} else if encoding == "deflate" {
+			bodyReader = flate.NewReader(recorder.Body)
+		}
+		body, err := io.ReadAll(bodyReader)
+		if err != nil {
+			t.Errorf("%s %s: Could not read body: %s", d.url, d.acceptEncoding, err)
+		}
+		if string(body) != d.body {
+			t.Errorf("%s %s: Unexpected body: %s", d.url, d.acceptEncoding, string(body))
+		}
+	}
+
+	// The ETag of the compressed variant remains strong, so that it can be
+	// used to update the resource.
+	for _, encoding := range []string{"gzip", "deflate"} {
+		request := httptest.NewRequest("GET", "/testers", nil)
+		request.Header.Set("Accept-Encoding", encoding)
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, request)
+		expected := encodedETag(makeETag(strings.Repeat("abcdef", 1000)), encoding)
+		etag := recorder.Header().Get("ETag")
+		if etag != expected {
+			t.Errorf("Expected %s, got %s", expected, etag)
+		}
+
+		request = httptest.NewRequest("GET", "/testers", nil)
+		request.Header.Set("Accept-Encoding", encoding)
+		request.Header.Set("If-None-Match", etag)
+		recorder = httptest.NewRecorder()
+		app.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusNotModified {
+			t.Errorf("Expected %d, got %d", http.StatusNotModified, recorder.Code)
+		}
+	}
+
+	app.SetCompression(nil)
+	var reader io.Reader
+	request, _ := http.NewRequest("GET", "/testers", reader)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, request)
+	if recorder.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Compression should be disabled")
+	}
+}
@@ -0,0 +1,181 @@
+package ripple
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handles Cross-Origin Resource Sharing (CORS). Use NewCors() to build it,
+// then register it as a middleware:
+//
+//	cors := ripple.NewCors()
+//	cors.AllowedOrigins = []string{"https://example.com", "https://*.example.com"}
+//	app.Use(cors.Handle)
+//
+// Preflight requests are answered automatically. The allowed methods are
+// computed from the controller actions that the URL resolves to, so if the
+// controller has Get and PostFriends methods, a preflight request on
+// "users/1/friends" allows POST but not GET.
+type Cors struct {
+	// The allowed origins. "*" allows any origin, and "*" can also be used as
+	// a wildcard within an origin, as in "https://*.example.com".
+	AllowedOrigins []string
+	// Origins matching any of these regular expressions are allowed too.
+	AllowedOriginPatterns []*regexp.Regexp
+	// If set, this function is called for the origins that are not allowed by
+	// AllowedOrigins or AllowedOriginPatterns. It returns true to allow the origin.
+	AllowOriginFunc func(origin string) bool
+	// Whether the response can be exposed when the request includes credentials
+	// (cookies, authorization headers, etc.). Credentials are never allowed for
+	// the origins that are only allowed by "*", since any site could then make
+	// credentialed requests.
+	AllowCredentials bool
+	// The headers the client is allowed to send. If empty, the headers requested
+	// in the preflight request are allowed.
+	AllowedHeaders []string
+	// The response headers that the client is allowed to read.
+	ExposedHeaders []string
+	// How long the result of a preflight request can be cached. Zero means that
+	// the Access-Control-Max-Age header is not sent.
+	MaxAge time.Duration
+}
+
+// Build a new CORS object. By default, any origin is allowed.
+func NewCors() *Cors {
+	output := new(Cors)
+	output.AllowedOrigins = []string{"*"}
+	return output
+}
+
+// Tells whether the given origin is allowed.
+func (this *Cors) IsOriginAllowed(origin string) bool {
+	for _, allowed := range this.AllowedOrigins {
+		if matchWildcard(allowed, origin) {
+			return true
+		}
+	}
+	for _, pattern := range this.AllowedOriginPatterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	if this.AllowOriginFunc != nil {
+		return this.AllowOriginFunc(origin)
+	}
+	return false
+}
+
+// Tells whether the origin is allowed by something else than the "*" origin.
+func (this *Cors) isOriginListed(origin string) bool {
+	for _, allowed := range this.AllowedOrigins {
+		if allowed != "*" && matchWildcard(allowed, origin) {
+			return true
+		}
+	}
+	for _, pattern := range this.AllowedOriginPatterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return this.AllowOriginFunc != nil && this.AllowOriginFunc(origin)
+}
+
+func (this *Cors) allowsAnyOrigin() bool {
+	for _, allowed := range this.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Implementation of Middleware.
+func (this *Cors) Handle(ctx *Context, next func()) {
+	request := ctx.Request
+	origin := request.Header.Get("Origin")
+	header := ctx.Response.Header
+	header.Add("Vary", "Origin")
+
+	if origin == "" || !this.IsOriginAllowed(origin) {
+		next()
+		return
+	}
+
+	isPreflight := request.Method == "OPTIONS" && request.Header.Get("Access-Control-Request-Method") != ""
+	if isPreflight {
+		this.handlePreflight(ctx, origin)
+		return
+	}
+
+	this.setOriginHeaders(header, origin)
+	if len(this.ExposedHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(this.ExposedHeaders, ", "))
+	}
+	next()
+}
+
+func (this *Cors) handlePreflight(ctx *Context, origin string) {
+	header := ctx.Response.Header
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	var methods []string
+	if ctx.Application() != nil {
+		methods = ctx.Application().AllowedMethods(ctx.Request)
+	}
+	if len(methods) == 0 {
+		ctx.Error(http.StatusNotFound, "")
+		return
+	}
+
+	this.setOriginHeaders(header, origin)
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(this.AllowedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(this.AllowedHeaders, ", "))
+	} else if requested := ctx.Request.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		header.Set("Access-Control-Allow-Headers", requested)
+	}
+	if this.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(this.MaxAge/time.Second)))
+	}
+	ctx.Response.Status = http.StatusNoContent
+	ctx.Response.Body = nil
+}
+
+func (this *Cors) setOriginHeaders(header http.Header, origin string) {
+	// "*" cannot be used when credentials are allowed, so in that case the
+	// origin is sent back as is. The origins that are only allowed by "*" do
+	// not get the credentials.
+	if this.allowsAnyOrigin() && (!this.AllowCredentials || !this.isOriginListed(origin)) {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if this.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// Tells whether the string matches the pattern, in which "*" matches any
+// sequence of characters.
+func matchWildcard(pattern string, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for i := 1; i < len(parts)-1; i++ {
+		index := strings.Index(s, parts[i])
+		if index < 0 {
+			return false
+		}
+		s = s[index+len(parts[i]):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
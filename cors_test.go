@@ -0,0 +1,158 @@
+package ripple
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	type MatchWildcardTest struct {
+		pattern  string
+		input    string
+		expected bool
+	}
+	var matchWildcardTests = []MatchWildcardTest{
+		{"*", "https://example.com", true},
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://example.org", false},
+		{"https://*.example.com", "https://api.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "http://api.example.com", false},
+		{"https://*.example.*", "https://api.example.org", true},
+	}
+	for _, d := range matchWildcardTests {
+		output := matchWildcard(d.pattern, d.input)
+		if output != d.expected {
+			t.Errorf("%s %s: Expected %t, got %t", d.pattern, d.input, d.expected, output)
+		}
+	}
+}
+
+func TestCorsIsOriginAllowed(t *testing.T) {
+	cors := NewCors()
+	cors.AllowedOrigins = []string{"https://example.com"}
+	cors.AllowedOriginPatterns = []*regexp.Regexp{regexp.MustCompile(`^https://[a-z]+\.example\.org$`)}
+	cors.AllowOriginFunc = func(origin string) bool { return origin == "http://localhost:3000" }
+
+	for origin, expected := range map[string]bool{
+		"https://example.com":     true,
+		"https://api.example.org": true,
+		"http://localhost:3000":   true,
+		"https://evil.com":        false,
+	} {
+		if cors.IsOriginAllowed(origin) != expected {
+			t.Errorf("%s: Expected %t", origin, expected)
+		}
+	}
+}
+
+type ControllerCorsTesters struct{}
+
+func (this *ControllerCorsTesters) Get(ctx *Context)         {}
+func (this *ControllerCorsTesters) Put(ctx *Context)         {}
+func (this *ControllerCorsTesters) PostFriends(ctx *Context) {}
+
+func TestCors(t *testing.T) {
+	cors := NewCors()
+	cors.AllowedOrigins = []string{"https://*.example.com"}
+	cors.AllowCredentials = true
+	cors.ExposedHeaders = []string{"X-Request-ID"}
+	cors.MaxAge = time.Hour
+
+	app := NewApplication()
+	app.RegisterController("users", &ControllerCorsTesters{})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+	app.Use(cors.Handle)
+
+	var reader io.Reader
+
+	request, _ := http.NewRequest("OPTIONS", "/users/1", reader)
+	request.Header.Set("Origin", "https://app.example.com")
+	request.Header.Set("Access-Control-Request-Method", "PUT")
+	request.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	ctx := app.Dispatch(request)
+	header := ctx.Response.Header
+	if ctx.Response.Status != http.StatusNoContent {
+		t.Errorf("Expected %d, got %d", http.StatusNoContent, ctx.Response.Status)
+	}
+	if header.Get("Access-Control-Allow-Methods") != "GET, PUT" {
+		t.Errorf("Expected %s, got %s", "GET, PUT", header.Get("Access-Control-Allow-Methods"))
+	}
+	if header.Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Expected %s, got %s", "https://app.example.com", header.Get("Access-Control-Allow-Origin"))
+	}
+	if header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Credentials not allowed")
+	}
+	if header.Get("Access-Control-Allow-Headers") != "Content-Type" {
+		t.Errorf("Expected %s, got %s", "Content-Type", header.Get("Access-Control-Allow-Headers"))
+	}
+	if header.Get("Access-Control-Max-Age") != "3600" {
+		t.Errorf("Expected %s, got %s", "3600", header.Get("Access-Control-Max-Age"))
+	}
+
+	request, _ = http.NewRequest("OPTIONS", "/users/1/friends", reader)
+	request.Header.Set("Origin", "https://app.example.com")
+	request.Header.Set("Access-Control-Request-Method", "POST")
+	ctx = app.Dispatch(request)
+	if ctx.Response.Header.Get("Access-Control-Allow-Methods") != "POST" {
+		t.Errorf("Expected %s, got %s", "POST", ctx.Response.Header.Get("Access-Control-Allow-Methods"))
+	}
+
+	request, _ = http.NewRequest("GET", "/users/1", reader)
+	request.Header.Set("Origin", "https://app.example.com")
+	ctx = app.Dispatch(request)
+	if ctx.Response.Status != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, ctx.Response.Status)
+	}
+	if ctx.Response.Header.Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+		t.Errorf("Expected %s, got %s", "X-Request-ID", ctx.Response.Header.Get("Access-Control-Expose-Headers"))
+	}
+
+	request, _ = http.NewRequest("GET", "/users/1", reader)
+	request.Header.Set("Origin", "https://evil.com")
+	ctx = app.Dispatch(request)
+	if ctx.Response.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Origin should not be allowed")
+	}
+}
+
+func TestCorsWildcardCredentials(t *testing.T) {
+	type testCase struct {
+		allowedOrigins []string
+		origin         string
+		allowOrigin    string
+		credentials    string
+	}
+
+	testCases := []testCase{
+		{[]string{"*"}, "https://evil.com", "*", ""},
+		{[]string{"*", "https://app.example.com"}, "https://evil.com", "*", ""},
+		{[]string{"*", "https://app.example.com"}, "https://app.example.com", "https://app.example.com", "true"},
+		{[]string{"https://app.example.com"}, "https://app.example.com", "https://app.example.com", "true"},
+	}
+
+	for i, d := range testCases {
+		cors := NewCors()
+		cors.AllowedOrigins = d.allowedOrigins
+		cors.AllowCredentials = true
+		app := NewApplication()
+		app.RegisterController("users", &ControllerCorsTesters{})
+		app.AddRoute(Route{Pattern: ":_controller/:id"})
+		app.Use(cors.Handle)
+
+		request, _ := http.NewRequest("GET", "/users/1", nil)
+		request.Header.Set("Origin", d.origin)
+		header := app.Dispatch(request).Response.Header
+		if header.Get("Access-Control-Allow-Origin") != d.allowOrigin {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.allowOrigin, header.Get("Access-Control-Allow-Origin"))
+		}
+		if header.Get("Access-Control-Allow-Credentials") != d.credentials {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.credentials, header.Get("Access-Control-Allow-Credentials"))
+		}
+	}
+}
@@ -15,7 +15,7 @@ package main
 import (
 	"../ripple"
 	"./controllers"
-	"net/http"
+	"log"
 )
 
 func main() {
@@ -37,7 +37,10 @@ func main() {
 	app.AddRoute(ripple.Route{Pattern: ":_controller/:id/"})
 	app.AddRoute(ripple.Route{Pattern: ":_controller"})
 
-	// Start the server
+	// Start the server. It stops gracefully on Ctrl+C.
 
-	http.ListenAndServe(":8080", app)
+	err := app.Run(":8080")
+	if err != nil {
+		log.Fatal(err)
+	}
 }
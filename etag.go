@@ -0,0 +1,154 @@
+package ripple
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Enables or disables the automatic generation of ETags (enabled by default).
+// When enabled, a strong ETag is computed from the body of the successful
+// GET and HEAD responses, unless the action has already set one.
+func (this *Application) SetAutoETag(v bool) {
+	this.autoETag = v
+}
+
+// Tells whether ETags are generated automatically.
+func (this *Application) AutoETag() bool {
+	return this.autoETag
+}
+
+// Sets the ETag and Last-Modified headers of the response, then checks them
+// against the If-None-Match and If-Modified-Since headers of the request. If
+// the client already has the current version of the resource, the status is
+// set to 304 Not Modified and the function returns true, in which case the
+// action can return straight away without building the body. etag can be
+// empty, and so can lastModified (zero time).
+//
+//	func (this *UserController) Get(ctx *ripple.Context) {
+//		user := this.userCollection.Get(userId)
+//		if ctx.NotModified(strconv.Itoa(user.Version), user.UpdatedTime) {
+//			return
+//		}
+//		ctx.Response.Body = user
+//	}
+func (this *Context) NotModified(etag string, lastModified time.Time) bool {
+	header := this.Response.Header
+	if etag != "" {
+		header.Set("ETag", quoteETag(etag))
+	}
+	if !lastModified.IsZero() {
+		header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if isNotModified(this.Request, header) {
+		this.Response.Status = http.StatusNotModified
+		this.Response.Body = nil
+		return true
+	}
+	return false
+}
+
+// Generates the ETag if needed, then tells whether the response should be
+// replaced by a 304 Not Modified. body is the serialized body, if known.
+func (this *Application) checkNotModified(request *http.Request, header http.Header, status int, body *string) bool {
+	if request.Method != "GET" && request.Method != "HEAD" {
+		return false
+	}
+	if status == http.StatusNotModified {
+		return true
+	}
+	if status != http.StatusOK {
+		return false
+	}
+	if this.autoETag && body != nil && header.Get("ETag") == "" {
+		header.Set("ETag", makeETag(*body))
+	}
+	return isNotModified(request, header)
+}
+
+// Evaluates the If-None-Match and If-Modified-Since headers of the request
+// against the ETag and Last-Modified headers of the response, as defined in
+// RFC 9110, section 13.2.2.
+func isNotModified(request *http.Request, header http.Header) bool {
+	if request.Method != "GET" && request.Method != "HEAD" {
+		return false
+	}
+
+	ifNoneMatch := request.Header.Get("If-None-Match")
+	if ifNoneMatch != "" {
+		return matchETag(ifNoneMatch, header.Get("ETag"), true)
+	}
+
+	ifModifiedSince := request.Header.Get("If-Modified-Since")
+	lastModified := header.Get("Last-Modified")
+	if ifModifiedSince == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// Tells whether the ETag matches one of the ETags in the list, which can also
+// be "*" to match any existing ETag. With weak comparison, the W/ prefixes
+// are ignored. With strong comparison, weak ETags never match. In both cases,
+// the ETags of the compressed variants match the ETag of the resource.
+func matchETag(list string, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if !weak && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if !weak && strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if decodedETag(strings.TrimPrefix(candidate, "W/")) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func makeETag(body string) string {
+	hash := sha256.Sum256([]byte(body))
+	return "\"" + hex.EncodeToString(hash[0:16]) + "\""
+}
+
+// Returns the ETag of the variant of the response compressed with the given
+// encoding, for example "abc-gzip" for "abc".
+func encodedETag(etag string, encoding string) string {
+	return strings.TrimSuffix(etag, "\"") + "-" + encoding + "\""
+}
+
+// Removes the encoding suffix added by encodedETag(), if any.
+func decodedETag(etag string) string {
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if strings.HasSuffix(etag, "-"+encoding+"\"") {
+			return strings.TrimSuffix(etag, "-"+encoding+"\"") + "\""
+		}
+	}
+	return etag
+}
+
+// Adds the quotes around the ETag if they are missing.
+func quoteETag(etag string) string {
+	if strings.HasSuffix(etag, "\"") {
+		return etag
+	}
+	return "\"" + etag + "\""
+}
@@ -0,0 +1,116 @@
+package ripple
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatchETag(t *testing.T) {
+	type MatchETagTest struct {
+		list     string
+		etag     string
+		weak     bool
+		expected bool
+	}
+	var matchETagTests = []MatchETagTest{
+		{"\"abc\"", "\"abc\"", true, true},
+		{"\"abc\"", "\"abc\"", false, true},
+		{"W/\"abc\"", "\"abc\"", true, true},
+		{"W/\"abc\"", "\"abc\"", false, false},
+		{"\"abc\"", "W/\"abc\"", false, false},
+		{"\"xyz\", W/\"abc\"", "\"abc\"", true, true},
+		{"\"xyz\"", "\"abc\"", true, false},
+		{"\"abc-gzip\"", "\"abc\"", false, true},
+		{"W/\"abc-deflate\"", "\"abc\"", true, true},
+		{"\"abc-br\"", "\"abc\"", false, false},
+		{"*", "\"abc\"", true, true},
+		{"*", "", true, false},
+	}
+	for _, d := range matchETagTests {
+		output := matchETag(d.list, d.etag, d.weak)
+		if output != d.expected {
+			t.Errorf("%s %s %t: Expected %t, got %t", d.list, d.etag, d.weak, d.expected, output)
+		}
+	}
+}
+
+var etagTestTime = time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+
+type ControllerETagTesters struct {
+	BodyBuilt bool
+}
+
+func (this *ControllerETagTesters) Get(ctx *Context) {
+	ctx.Response.Body = "hello"
+}
+
+func (this *ControllerETagTesters) GetVersioned(ctx *Context) {
+	this.BodyBuilt = false
+	if ctx.NotModified("v2", etagTestTime) {
+		return
+	}
+	this.BodyBuilt = true
+	ctx.Response.Body = "versioned"
+}
+
+func TestConditionalGet(t *testing.T) {
+	var controller ControllerETagTesters
+	app := NewApplication()
+	app.RegisterController("testers", &controller)
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:_action"})
+
+	serve := func(url string, header string, value string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		request, _ := http.NewRequest("GET", url, reader)
+		if header != "" {
+			request.Header.Set(header, value)
+		}
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	r := serve("/testers", "", "")
+	etag := r.Header().Get("ETag")
+	if r.Code != http.StatusOK || etag != makeETag("hello") {
+		t.Errorf("Expected ETag %s, got %s", makeETag("hello"), etag)
+	}
+	r = serve("/testers", "If-None-Match", etag)
+	if r.Code != http.StatusNotModified || r.Body.Len() != 0 {
+		t.Errorf("Expected %d with empty body, got %d", http.StatusNotModified, r.Code)
+	}
+	r = serve("/testers", "If-None-Match", "W/"+etag)
+	if r.Code != http.StatusNotModified {
+		t.Errorf("Expected %d, got %d", http.StatusNotModified, r.Code)
+	}
+	r = serve("/testers", "If-None-Match", "\"other\"")
+	if r.Code != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, r.Code)
+	}
+
+	r = serve("/testers/versioned", "If-None-Match", "\"v2\"")
+	if r.Code != http.StatusNotModified || controller.BodyBuilt {
+		t.Errorf("Expected %d without building the body, got %d", http.StatusNotModified, r.Code)
+	}
+	r = serve("/testers/versioned", "If-Modified-Since", etagTestTime.Add(time.Hour).Format(http.TimeFormat))
+	if r.Code != http.StatusNotModified {
+		t.Errorf("Expected %d, got %d", http.StatusNotModified, r.Code)
+	}
+	r = serve("/testers/versioned", "If-Modified-Since", etagTestTime.Add(-time.Hour).Format(http.TimeFormat))
+	if r.Code != http.StatusOK || r.Body.String() != "versioned" {
+		t.Errorf("Expected %d, got %d", http.StatusOK, r.Code)
+	}
+	if r.Header().Get("ETag") != "\"v2\"" || r.Header().Get("Last-Modified") != etagTestTime.Format(http.TimeFormat) {
+		t.Errorf("Unexpected validators: %s, %s", r.Header().Get("ETag"), r.Header().Get("Last-Modified"))
+	}
+
+	app.SetAutoETag(false)
+	r = serve("/testers", "", "")
+	if r.Header().Get("ETag") != "" {
+		t.Errorf("ETag should not be generated")
+	}
+}
@@ -0,0 +1,207 @@
+package ripple
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The fuzz targets run on their seed corpus with "go test". To fuzz them:
+//
+//	go test -fuzz=FuzzMatchRequest
+
+func newFuzzApplication(baseUrl string) *Application {
+	app := NewApplication()
+	app.SetBaseUrl(baseUrl)
+	app.RegisterController("testers", &ControllerTesters{})
+	app.RegisterController("other", &ControllerTesters4{})
+	app.RegisterController("custom", &ControllerTesters3{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+	app.AddRoute(Route{Pattern: "misc/:name", Controller: "other", Action: "other"})
+	app.AddRoute(Route{Pattern: "custom/:_action", Controller: "custom"})
+	return app
+}
+
+func FuzzSplitPath(f *testing.F) {
+	for _, seed := range []string{"", "/", "//", "/users", "users/", "/users//1/", "a/b/c", ":_controller/:id", "/%2F/"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, path string) {
+		tokens := splitPath(path)
+		var expected []string
+		for _, s := range strings.Split(path, "/") {
+			if s != "" {
+				expected = append(expected, s)
+			}
+		}
+		if strings.Join(tokens, "/") != strings.Join(expected, "/") || len(tokens) != len(expected) {
+			t.Errorf("Expected %q, got %q", expected, tokens)
+		}
+		for _, token := range tokens {
+			if token == "" || strings.Contains(token, "/") {
+				t.Errorf("Invalid token %q in %q", token, tokens)
+			}
+		}
+	})
+}
+
+func FuzzMatchRequest(f *testing.F) {
+	seeds := []struct {
+		baseUrl string
+		method  string
+		path    string
+	}{
+		{"", "GET", "/testers"},
+		{"", "GET", "//testers//1//"},
+		{"", "POST", "/testers/1/tasks"},
+		{"", "GET", "/misc/abc"},
+		{"", "POSTCUSTOM", "/custom"},
+		{"/api/", "GET", "/"},
+		{"/api/", "GET", "/api"},
+		{"/api/", "GET", "/api/testers/1"},
+		{"/api/", "GET", "/other/testers"},
+		{"http://example.com/api", "GET", ""},
+	}
+	for _, seed := range seeds {
+		f.Add(seed.baseUrl, seed.method, seed.path)
+	}
+	f.Fuzz(func(t *testing.T, baseUrl string, method string, path string) {
+		if _, err := url.Parse(baseUrl); err != nil {
+			t.Skip()
+		}
+		app := newFuzzApplication(baseUrl)
+		request := &http.Request{Method: method, URL: &url.URL{Path: path}, Header: http.Header{}}
+		match := app.matchRequest(request)
+		if !match.Success {
+			return
+		}
+		if _, ok := app.controllers[match.ControllerName]; !ok {
+			t.Errorf("%s %s: Matched unknown controller %q", method, path, match.ControllerName)
+		}
+		if !match.ControllerMethod.IsValid() {
+			t.Errorf("%s %s: Matched invalid method", method, path)
+		}
+		for name, value := range match.Params {
+			if value == "" || strings.Contains(value, "/") {
+				t.Errorf("%s %s: Invalid parameter %s=%q", method, path, name, value)
+			}
+		}
+	})
+}
+
+func FuzzURLFor(f *testing.F) {
+	seeds := []struct {
+		controller string
+		action     string
+		id         string
+		extra      string
+	}{
+		{"testers", "", "", ""},
+		{"testers", "", "1", "2"},
+		{"testers", "tasks", "a b", ""},
+		{"testers", "tasks", "a/b", ""},
+		{"other", "other", "x", "é?&="},
+		{"custom", "new", "", ""},
+		{"nope", "", "1", ""},
+	}
+	for _, seed := range seeds {
+		f.Add(seed.controller, seed.action, seed.id, seed.extra)
+	}
+	f.Fuzz(func(t *testing.T, controllerName string, actionName string, id string, extra string) {
+		app := newFuzzApplication("/api/")
+		params := map[string]string{"id": id, "name": id, "extra": extra}
+		u, candidate, err := app.urlFor(controllerName, actionName, params)
+		if err != nil {
+			// The actions of the registered controllers can always be reached
+			// with a non-empty ID, unless it is a dot segment.
+			reachable := (controllerName == "testers" && (actionName == "" || actionName == "tasks")) || (controllerName == "other" && actionName == "other")
+			if reachable && id != "" && id != "." && id != ".." {
+				t.Errorf("URLFor(%q, %q, %q): Expected a URL, got %s", controllerName, actionName, params, err)
+			}
+			return
+		}
+
+		parsed, err := url.Parse(u)
+		if err != nil {
+			t.Fatalf("URLFor(%q, %q, %q) returned an invalid URL %q: %s", controllerName, actionName, params, u, err)
+		}
+		query := parsed.Query()
+		for name, value := range params {
+			if candidate.used[name] == query.Has(name) {
+				t.Errorf("URLFor(%q, %q, %q) returned %q, which has %q in both or neither the path and the query", controllerName, actionName, params, u, name)
+			}
+			if !candidate.used[name] && query.Get(name) != value {
+				t.Errorf("URLFor(%q, %q, %q) returned %q: Expected %s = %q in the query, got %q", controllerName, actionName, params, u, name, value, query.Get(name))
+			}
+		}
+		for _, requestMethod := range app.requestMethods() {
+			match := app.matchRequest(&http.Request{Method: requestMethod, URL: parsed, Header: http.Header{}})
+			if !match.Success || match.ControllerName != controllerName || match.ActionName != actionName {
+				continue
+			}
+			if !sameRoute(match.MatchedRoute, candidate.route) {
+				t.Errorf("URLFor(%q, %q, %q) returned %q: Expected route %q, got %q", controllerName, actionName, params, u, candidate.route.Pattern, match.MatchedRoute.Pattern)
+			}
+			// The path parameters must round-trip through the path, not
+			// the query string.
+			matched := true
+			for name := range candidate.used {
+				if match.Params[name] != params[name] {
+					matched = false
+				}
+			}
+			if matched {
+				return
+			}
+		}
+		t.Errorf("URLFor(%q, %q, %q) returned %q, which does not lead back to the action", controllerName, actionName, params, u)
+	})
+}
+
+func FuzzSerializeResponseBody(f *testing.F) {
+	f.Add("", int64(0), uint64(0), 0.0, false)
+	f.Add("abc", int64(-1), uint64(math.MaxUint64), 1.5, true)
+	f.Add("\x00\xff", int64(math.MinInt64), uint64(300), math.Inf(1), false)
+	f.Add("", int64(math.MaxInt64), uint64(math.MaxUint32+1), math.NaN(), false)
+	f.Add("", int64(1)<<40, uint64(1)<<40, math.MaxFloat64, false)
+	f.Fuzz(func(t *testing.T, s string, i int64, u uint64, fl float64, b bool) {
+		app := NewApplication()
+		bodies := []interface{}{
+			s, i, int(i), int8(i), int16(i), int32(i),
+			u, uint(u), uint8(u), uint16(u), uint32(u),
+			fl, float32(fl), b,
+			map[string]interface{}{"s": s, "i": i, "b": b},
+			[]string{s},
+		}
+		for _, body := range bodies {
+			output, err := app.serializeResponseBody(body)
+			if err != nil {
+				continue
+			}
+			value := reflect.ValueOf(body)
+			switch value.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				if output != strconv.FormatInt(value.Int(), 10) {
+					t.Errorf("%T: Expected %d, got %s", body, value.Int(), output)
+				}
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				if output != strconv.FormatUint(value.Uint(), 10) {
+					t.Errorf("%T: Expected %d, got %s", body, value.Uint(), output)
+				}
+			case reflect.Float32, reflect.Float64:
+				parsed, err := strconv.ParseFloat(output, value.Type().Bits())
+				if err != nil {
+					t.Errorf("%T: Expected a number, got %s", body, output)
+				} else if math.IsNaN(value.Float()) != math.IsNaN(parsed) || (!math.IsNaN(parsed) && parsed != value.Float()) {
+					t.Errorf("%T: Expected %v, got %s", body, body, output)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,278 @@
+package ripple
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The status of a health check or report.
+const (
+	HealthOk       = "ok"
+	HealthDegraded = "degraded"
+	HealthFailing  = "failing"
+)
+
+// A check of a dependency of the application, such as a database or a remote
+// service, run by the /healthz and /readyz endpoints.
+type HealthCheck struct {
+	// The name of the check in the reports. Must be unique.
+	Name string
+	// Returns an error if the dependency is not healthy. It should stop when
+	// the context is cancelled.
+	Check func(ctx context.Context) error
+	// The maximum duration of the check (default to 5 seconds).
+	Timeout time.Duration
+	// If true, the application is not ready when the check fails. Otherwise,
+	// the failure is reported but the application is only degraded.
+	Critical bool
+	// If true, the check also runs for the liveness endpoint, which otherwise
+	// only tells whether the application can serve requests. Only the checks
+	// whose failure requires restarting the process should be liveness checks.
+	Liveness bool
+	// How long the result of the check is reused (default to 0, which runs
+	// the check for every request).
+	CacheTTL time.Duration
+}
+
+// Controllers that implement HealthCheckProvider have their checks added to
+// the health endpoints when they are registered.
+type HealthCheckProvider interface {
+	HealthChecks() []HealthCheck
+}
+
+// The result of a health check.
+type HealthCheckResult struct {
+	Status   string
+	Critical bool
+	Error    string `json:",omitempty"`
+	Duration string `json:",omitempty"`
+	// True if the result comes from the cache.
+	Cached bool `json:",omitempty"`
+
+	checked time.Time
+}
+
+// The response of the health endpoints.
+type HealthReport struct {
+	// HealthOk, HealthDegraded if a non-critical check fails, or HealthFailing
+	// if a critical check fails or if the application is shutting down.
+	Status       string
+	ShuttingDown bool `json:",omitempty"`
+	Checks       map[string]HealthCheckResult
+}
+
+type health struct {
+	mutex         sync.Mutex
+	livenessPath  string
+	readinessPath string
+	checks        []HealthCheck
+	results       map[string]HealthCheckResult
+	details       bool
+	now           func() time.Time
+}
+
+func newHealth() *health {
+	output := new(health)
+	output.livenessPath = "/healthz"
+	output.readinessPath = "/readyz"
+	output.results = make(map[string]HealthCheckResult)
+	output.now = time.Now
+	return output
+}
+
+// Sets the paths of the liveness and readiness endpoints (default to
+// "/healthz" and "/readyz"). The paths are relative to the base URL, and an
+// empty path disables the endpoint. The endpoints are served before the
+// middlewares and the controller routes, so that they do not require
+// authentication and are not rate limited.
+func (this *Application) SetHealthPaths(livenessPath string, readinessPath string) {
+	this.health.livenessPath = livenessPath
+	this.health.readinessPath = readinessPath
+}
+
+// Sets whether the health endpoints include the error and duration of the
+// checks (default to false). Since the endpoints do not require
+// authentication, the errors, which may reveal host names or connection
+// strings, are only shown when enabled. CheckLiveness() and CheckReadiness()
+// always return them.
+func (this *Application) SetHealthDetails(v bool) {
+	this.health.details = v
+}
+
+// Tells whether the health endpoints include the details of the checks.
+func (this *Application) HealthDetails() bool {
+	return this.health.details
+}
+
+// Adds a check to the health endpoints.
+func (this *Application) AddHealthCheck(check HealthCheck) {
+	this.health.mutex.Lock()
+	defer this.health.mutex.Unlock()
+	this.health.checks = append(this.health.checks, check)
+}
+
+// Runs the liveness checks. The report fails only if a critical liveness
+// check fails.
+func (this *Application) CheckLiveness(ctx context.Context) HealthReport {
+	return this.checkHealth(ctx, true)
+}
+
+// Runs all the checks. The report fails if a critical check fails or if the
+// application is shutting down, so that load balancers stop sending requests
+// to it while the in-flight requests complete (see SetShutdownDelay()).
+func (this *Application) CheckReadiness(ctx context.Context) HealthReport {
+	return this.checkHealth(ctx, false)
+}
+
+func (this *Application) checkHealth(ctx context.Context, liveness bool) HealthReport {
+	this.health.mutex.Lock()
+	var checks []HealthCheck
+	for _, check := range this.health.checks {
+		if check.Liveness || !liveness {
+			checks = append(checks, check)
+		}
+	}
+	this.health.mutex.Unlock()
+
+	output := HealthReport{Status: HealthOk, Checks: make(map[string]HealthCheckResult)}
+	results := make([]HealthCheckResult, len(checks))
+	var wait sync.WaitGroup
+	for i, check := range checks {
+		wait.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wait.Done()
+			results[i] = this.runHealthCheck(ctx, check)
+		}(i, check)
+	}
+	wait.Wait()
+
+	for i, check := range checks {
+		output.Checks[check.Name] = results[i]
+		if results[i].Status == HealthOk {
+			continue
+		}
+		if check.Critical {
+			output.Status = HealthFailing
+		} else if output.Status == HealthOk {
+			output.Status = HealthDegraded
+		}
+	}
+	if !liveness && this.ShuttingDown() {
+		output.ShuttingDown = true
+		output.Status = HealthFailing
+	}
+	return output
+}
+
+// Runs the check, or returns its cached result.
+func (this *Application) runHealthCheck(ctx context.Context, check HealthCheck) HealthCheckResult {
+	now := this.health.now()
+	if check.CacheTTL > 0 {
+		this.health.mutex.Lock()
+		result, ok := this.health.results[check.Name]
+		this.health.mutex.Unlock()
+		if ok && now.Sub(result.checked) < check.CacheTTL {
+			result.Cached = true
+			return result
+		}
+	}
+
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The check runs in its own goroutine so that a check that ignores the
+	// context cannot block the endpoint.
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- errors.New("check panicked")
+			}
+		}()
+		done <- check.Check(checkCtx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-checkCtx.Done():
+		err = checkCtx.Err()
+	}
+
+	output := HealthCheckResult{Status: HealthOk, Critical: check.Critical, checked: now}
+	output.Duration = this.health.now().Sub(now).String()
+	if err != nil {
+		output.Status = HealthFailing
+		output.Error = err.Error()
+	}
+
+	if check.CacheTTL > 0 {
+		this.health.mutex.Lock()
+		this.health.results[check.Name] = output
+		this.health.mutex.Unlock()
+	}
+	return output
+}
+
+// Adds the checks of the controller, if it is a HealthCheckProvider.
+func (this *Application) registerHealthChecks(controller interface{}) {
+	provider, ok := controller.(HealthCheckProvider)
+	if !ok {
+		return
+	}
+	for _, check := range provider.HealthChecks() {
+		this.AddHealthCheck(check)
+	}
+}
+
+// Serves the request if it targets one of the health endpoints. Returns false
+// otherwise.
+func (this *Application) serveHealth(writter http.ResponseWriter, request *http.Request) bool {
+	if request.Method != "GET" && request.Method != "HEAD" {
+		return false
+	}
+	tokens, _, ok := this.requestPathTokens(request.URL)
+	if !ok {
+		return false
+	}
+	path := "/" + strings.Join(tokens, "/")
+
+	var report HealthReport
+	if this.health.livenessPath != "" && path == "/"+strings.Trim(this.health.livenessPath, "/") {
+		report = this.CheckLiveness(request.Context())
+	} else if this.health.readinessPath != "" && path == "/"+strings.Trim(this.health.readinessPath, "/") {
+		report = this.CheckReadiness(request.Context())
+	} else {
+		return false
+	}
+
+	if !this.health.details {
+		for name, result := range report.Checks {
+			result.Error = ""
+			result.Duration = ""
+			report.Checks[name] = result
+		}
+	}
+
+	body, _ := json.Marshal(report)
+	status := http.StatusOK
+	if report.Status == HealthFailing {
+		status = http.StatusServiceUnavailable
+	}
+	writter.Header().Set("Content-Type", "application/json")
+	writter.Header().Set("Cache-Control", "no-store")
+	writter.WriteHeader(status)
+	if request.Method != "HEAD" {
+		writter.Write(body)
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package ripple
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type ControllerHealthTester struct{}
+
+func (this *ControllerHealthTester) Get(ctx *Context) {}
+
+func (this *ControllerHealthTester) HealthChecks() []HealthCheck {
+	return []HealthCheck{
+		{Name: "cache", Check: func(ctx context.Context) error { return errors.New("cache is down") }},
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	type testCase struct {
+		checks       []HealthCheck
+		shuttingDown bool
+		url          string
+		status       int
+		expected     map[string]string
+	}
+
+	ok := func(ctx context.Context) error { return nil }
+	fail := func(ctx context.Context) error { return errors.New("down") }
+	block := func(ctx context.Context) error { time.Sleep(time.Second); return nil }
+
+	testCases := []testCase{
+		{nil, false, "/api/healthz", http.StatusOK, map[string]string{"": "ok"}},
+		{nil, false, "/api/readyz", http.StatusOK, map[string]string{"": "degraded", "cache": "failing"}},
+		{nil, true, "/api/readyz", http.StatusServiceUnavailable, map[string]string{"": "failing", "cache": "failing"}},
+		{nil, true, "/api/healthz", http.StatusOK, map[string]string{"": "ok"}},
+		{[]HealthCheck{{Name: "db", Check: ok, Critical: true}}, false, "/api/readyz/", http.StatusOK, map[string]string{"": "degraded", "db": "ok", "cache": "failing"}},
+		{[]HealthCheck{{Name: "db", Check: fail, Critical: true}}, false, "/api/readyz", http.StatusServiceUnavailable, map[string]string{"": "failing", "db": "failing", "cache": "failing"}},
+		{[]HealthCheck{{Name: "db", Check: fail, Critical: true}}, false, "/api/healthz", http.StatusOK, map[string]string{"": "ok"}},
+		{[]HealthCheck{{Name: "db", Check: fail, Critical: true, Liveness: true}}, false, "/api/healthz", http.StatusServiceUnavailable, map[string]string{"": "failing", "db": "failing"}},
+		{[]HealthCheck{{Name: "db", Check: block, Critical: true, Liveness: true, Timeout: 10 * time.Millisecond}}, false, "/api/healthz", http.StatusServiceUnavailable, map[string]string{"": "failing", "db": "failing"}},
+		{nil, false, "/healthz", http.StatusUnauthorized, nil},
+		{nil, false, "/api/other", http.StatusUnauthorized, nil},
+	}
+
+	for i, d := range testCases {
+		app := NewApplication()
+		app.SetBaseUrl("/api/")
+		app.RegisterController("health", &ControllerHealthTester{})
+		app.AddRoute(Route{Pattern: ":_controller"})
+		app.Use(func(ctx *Context, next func()) {
+			ctx.Error(http.StatusUnauthorized, "")
+		})
+		for _, check := range d.checks {
+			app.AddHealthCheck(check)
+		}
+		app.lifecycle.shuttingDown = d.shuttingDown
+
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, httptest.NewRequest("GET", d.url, nil))
+		if recorder.Code != d.status {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.status, recorder.Code)
+		}
+		if d.expected == nil {
+			continue
+		}
+
+		var report HealthReport
+		err := json.Unmarshal(recorder.Body.Bytes(), &report)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %s", i, err)
+		}
+		actual := map[string]string{"": report.Status}
+		for name, result := range report.Checks {
+			actual[name] = result.Status
+		}
+		if !reflect.DeepEqual(actual, d.expected) {
+			t.Errorf("Test %d: Expected %v, got %v", i, d.expected, actual)
+		}
+		if report.ShuttingDown != (d.shuttingDown && d.url == "/api/readyz") {
+			t.Errorf("Test %d: Expected %t, got %t", i, d.shuttingDown, report.ShuttingDown)
+		}
+		if recorder.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("Test %d: Expected %s, got %s", i, "no-store", recorder.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestHealthDetails(t *testing.T) {
+	for _, details := range []bool{false, true} {
+		app := NewApplication()
+		app.SetHealthDetails(details)
+		app.AddHealthCheck(HealthCheck{Name: "db", Check: func(ctx context.Context) error {
+			return errors.New("dial tcp db.internal:5432: connection refused")
+		}})
+
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+		var report HealthReport
+		err := json.Unmarshal(recorder.Body.Bytes(), &report)
+		if err != nil {
+			t.Errorf("%t: Expected no error, got %s", details, err)
+		}
+		if report.Checks["db"].Status != HealthFailing {
+			t.Errorf("%t: Expected %s, got %s", details, HealthFailing, report.Checks["db"].Status)
+		}
+		if (report.Checks["db"].Error != "") != details || (report.Checks["db"].Duration != "") != details {
+			t.Errorf("%t: Unexpected details: %v", details, report.Checks["db"])
+		}
+	}
+}
+
+func TestHealthCheckCache(t *testing.T) {
+	app := NewApplication()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	app.health.now = func() time.Time { return now }
+	count := 0
+	app.AddHealthCheck(HealthCheck{
+		Name:     "db",
+		CacheTTL: time.Minute,
+		Check: func(ctx context.Context) error {
+			count++
+			if count > 1 {
+				return errors.New("down")
+			}
+			return nil
+		},
+	})
+
+	type testCase struct {
+		advance time.Duration
+		status  string
+		cached  bool
+		count   int
+	}
+
+	testCases := []testCase{
+		{0, HealthOk, false, 1},
+		{30 * time.Second, HealthOk, true, 1},
+		{30 * time.Second, HealthDegraded, false, 2},
+		{10 * time.Second, HealthDegraded, true, 2},
+	}
+
+	for i, d := range testCases {
+		now = now.Add(d.advance)
+		report := app.CheckReadiness(context.Background())
+		if report.Status != d.status {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.status, report.Status)
+		}
+		if report.Checks["db"].Cached != d.cached {
+			t.Errorf("Test %d: Expected %t, got %t", i, d.cached, report.Checks["db"].Cached)
+		}
+		if count != d.count {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.count, count)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package ripple
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A request processed with an idempotency key, and its response once
+// it has completed.
+type IdempotencyRecord struct {
+	// Identifies the request (method, path, query and body), to detect when a
+	// key is reused for a different request.
+	Fingerprint string
+	// False while the request is being processed.
+	Completed bool
+	Status    int
+	Header    http.Header
+	Body      string
+}
+
+// Stores the idempotency records. NewMemoryIdempotencyStore() builds an
+// in-memory store; other implementations can be used to share the records
+// between several servers.
+type IdempotencyStore interface {
+	// Returns the record of the key if it exists. Otherwise, atomically
+	// creates an in-progress record with the given fingerprint, and returns nil.
+	Begin(key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error)
+	// Saves the response of the request, which has now completed.
+	Complete(key string, record *IdempotencyRecord, ttl time.Duration) error
+	// Deletes the record, so that the request can be retried.
+	Release(key string) error
+}
+
+// A middleware that makes POST requests idempotent using the Idempotency-Key
+// header. The first response for a given key is stored and replayed when the
+// client retries the request with the same key, so the action only runs
+// once. Use NewIdempotency() to build it:
+//
+//	app.UseController("users", ripple.NewIdempotency().Handle)
+//
+// If a request arrives while another one with the same key is still being
+// processed, the client receives a 409 Conflict response. If the key is
+// reused for a different request (different method, path, query or body), it
+// receives a 422 Unprocessable Entity response. Server errors (5xx) and
+// streamed responses are not stored, so those requests can be retried. The
+// headers that only apply to the first request, such as the CORS, rate limit
+// and Set-Cookie headers, are not replayed.
+//
+// Keys are scoped to the authenticated principal, so the Auth middleware must
+// run before this one. Requests without a principal are scoped to the IP
+// address of the client instead.
+type Idempotency struct {
+	// The name of the header holding the key (default to "Idempotency-Key").
+	Header string
+	// The request methods concerned (default to POST only).
+	Methods []string
+	// How long the responses are kept (default to 24 hours).
+	TTL time.Duration
+	// The maximum size of the request bodies, which are read to detect when
+	// a key is reused for a different request (default to 1 MB). Larger
+	// requests receive a 413 Request Entity Too Large response.
+	MaxBodySize int64
+	Store       IdempotencyStore
+}
+
+// Build a new idempotency middleware with an in-memory store.
+func NewIdempotency() *Idempotency {
+	output := new(Idempotency)
+	output.Header = "Idempotency-Key"
+	output.Methods = []string{"POST"}
+	output.TTL = 24 * time.Hour
+	output.MaxBodySize = 1 << 20
+	output.Store = NewMemoryIdempotencyStore()
+	return output
+}
+
+// Implementation of Middleware.
+func (this *Idempotency) Handle(ctx *Context, next func()) {
+	key := ctx.Request.Header.Get(this.Header)
+	if key == "" || !containsString(this.Methods, ctx.Request.Method) {
+		next()
+		return
+	}
+
+	// Keys are only unique per client, so they are scoped to the principal,
+	// or to the IP address if the request is not authenticated.
+	key = RateLimitByPrincipal(ctx) + ":" + key
+
+	fingerprint, err := requestFingerprint(ctx.Request, this.MaxBodySize)
+	if err == errIdempotencyBodyTooLarge {
+		ctx.Error(http.StatusRequestEntityTooLarge, "Request body is too large")
+		return
+	}
+	if err != nil {
+		ctx.Error(http.StatusBadRequest, "Could not read request body")
+		return
+	}
+
+	record, err := this.Store.Begin(key, fingerprint, this.TTL)
+	if err != nil {
+		log.Printf("[%s] Idempotency store error: %s\n", ctx.RequestID(), err)
+		next()
+		return
+	}
+
+	if record != nil {
+		if record.Fingerprint != fingerprint {
+			ctx.Error(http.StatusUnprocessableEntity, "Idempotency key has already been used for a different request")
+		} else if !record.Completed {
+			ctx.Error(http.StatusConflict, "A request with the same idempotency key is being processed")
+		} else {
+			this.replay(ctx, record)
+		}
+		return
+	}
+
+	completed := false
+	defer func() {
+		if !completed {
+			this.release(ctx, key)
+		}
+	}()
+
+	next()
+
+	if ctx.Response.Status >= 500 {
+		return
+	}
+	if _, ok := ctx.Response.Body.(io.Reader); ok || ctx.Application() == nil {
+		return
+	}
+	body, err := ctx.Application().serializeResponseBody(ctx.Response.Body)
+	if err != nil {
+		return
+	}
+
+	record = new(IdempotencyRecord)
+	record.Fingerprint = fingerprint
+	record.Completed = true
+	record.Status = ctx.Response.Status
+	record.Header = storableHeader(ctx.Response.Header, ctx.Application().RequestIDHeader())
+	record.Body = body
+	err = this.Store.Complete(key, record, this.TTL)
+	if err != nil {
+		log.Printf("[%s] Idempotency store error: %s\n", ctx.RequestID(), err)
+		return
+	}
+	completed = true
+}
+
+func (this *Idempotency) release(ctx *Context, key string) {
+	err := this.Store.Release(key)
+	if err != nil {
+		log.Printf("[%s] Idempotency store error: %s\n", ctx.RequestID(), err)
+	}
+}
+
+func (this *Idempotency) replay(ctx *Context, record *IdempotencyRecord) {
+	replayHeader(ctx.Response.Header, record.Header)
+	ctx.Response.Header.Set("Idempotent-Replayed", "true")
+	ctx.Response.Status = record.Status
+	ctx.Response.Body = record.Body
+}
+
+var errIdempotencyBodyTooLarge = errors.New("request body is too large")
+
+// Reads the request body to compute the fingerprint, then restores it so
+// that the action can read it too. Returns errIdempotencyBodyTooLarge if the
+// body is larger than maxSize bytes.
+func requestFingerprint(request *http.Request, maxSize int64) (string, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(request.Body, maxSize+1))
+		if err != nil {
+			return "", err
+		}
+		if int64(len(body)) > maxSize {
+			return "", errIdempotencyBodyTooLarge
+		}
+		request.Body.Close()
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.Path + "?" + request.URL.Query().Encode() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+type memoryIdempotencyEntry struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+// An in-memory IdempotencyStore. Expired records are removed periodically.
+type MemoryIdempotencyStore struct {
+	mutex   sync.Mutex
+	entries map[string]*memoryIdempotencyEntry
+	calls   int
+	now     func() time.Time
+}
+
+// Build a new in-memory idempotency store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	output := new(MemoryIdempotencyStore)
+	output.entries = make(map[string]*memoryIdempotencyEntry)
+	output.now = time.Now
+	return output
+}
+
+// Implementation of IdempotencyStore.
+func (this *MemoryIdempotencyStore) Begin(key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	now := this.now()
+	this.calls++
+	if this.calls%1024 == 0 {
+		for k, entry := range this.entries {
+			if now.After(entry.expires) {
+				delete(this.entries, k)
+			}
+		}
+	}
+
+	entry, ok := this.entries[key]
+	if ok && now.Before(entry.expires) {
+		record := entry.record
+		return &record, nil
+	}
+
+	entry = new(memoryIdempotencyEntry)
+	entry.record.Fingerprint = fingerprint
+	entry.expires = now.Add(ttl)
+	this.entries[key] = entry
+	return nil, nil
+}
+
+// Implementation of IdempotencyStore.
+func (this *MemoryIdempotencyStore) Complete(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	entry := new(memoryIdempotencyEntry)
+	entry.record = *record
+	entry.expires = this.now().Add(ttl)
+	this.entries[key] = entry
+	return nil
+}
+
+// Implementation of IdempotencyStore.
+func (this *MemoryIdempotencyStore) Release(key string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	delete(this.entries, key)
+	return nil
+}
@@ -0,0 +1,260 @@
+package ripple
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ControllerIdempotencyTester struct {
+	calls   int
+	status  int
+	started chan bool
+	release chan bool
+}
+
+func (this *ControllerIdempotencyTester) Post(ctx *Context) {
+	if this.started != nil {
+		this.started <- true
+		<-this.release
+	}
+	this.calls++
+	body, _ := io.ReadAll(ctx.Request.Body)
+	ctx.Response.Header.Set("Location", "/users/"+strconv.Itoa(this.calls))
+	if this.status != 0 {
+		ctx.Response.Status = this.status
+	} else {
+		ctx.Response.Status = http.StatusCreated
+	}
+	ctx.Response.Body = map[string]interface{}{"id": this.calls, "body": string(body)}
+}
+
+func TestIdempotency(t *testing.T) {
+	app := NewApplication()
+	controller := &ControllerIdempotencyTester{}
+	app.RegisterController("users", controller)
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.UseController("users", NewIdempotency().Handle)
+
+	dispatch := func(key string, body string) *Context {
+		request, _ := http.NewRequest("POST", "/users", strings.NewReader(body))
+		if key != "" {
+			request.Header.Set("Idempotency-Key", key)
+		}
+		return app.Dispatch(request)
+	}
+
+	first := dispatch("abc", "john")
+	if first.Response.Status != http.StatusCreated {
+		t.Errorf("Expected %d, got %d", http.StatusCreated, first.Response.Status)
+	}
+
+	replayed := dispatch("abc", "john")
+	if controller.calls != 1 {
+		t.Errorf("Expected %d, got %d", 1, controller.calls)
+	}
+	if replayed.Response.Status != http.StatusCreated {
+		t.Errorf("Expected %d, got %d", http.StatusCreated, replayed.Response.Status)
+	}
+	if replayed.Response.Header.Get("Location") != "/users/1" {
+		t.Errorf("Expected %s, got %s", "/users/1", replayed.Response.Header.Get("Location"))
+	}
+	if replayed.Response.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected %s, got %s", "true", replayed.Response.Header.Get("Idempotent-Replayed"))
+	}
+	expected := "{\"body\":\"john\",\"id\":1}"
+	if replayed.Response.Body != expected {
+		t.Errorf("Expected %s, got %s", expected, replayed.Response.Body)
+	}
+	if replayed.Response.Header.Get("X-Request-ID") == first.Response.Header.Get("X-Request-ID") {
+		t.Errorf("Request ID should not be replayed")
+	}
+
+	ctx := dispatch("abc", "jane")
+	if ctx.Response.Status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected %d, got %d", http.StatusUnprocessableEntity, ctx.Response.Status)
+	}
+
+	dispatch("", "john")
+	dispatch("", "john")
+	if controller.calls != 3 {
+		t.Errorf("Expected %d, got %d", 3, controller.calls)
+	}
+
+	// Server errors are not stored, so the request can be retried.
+	controller.status = http.StatusInternalServerError
+	dispatch("def", "john")
+	controller.status = 0
+	ctx = dispatch("def", "john")
+	if ctx.Response.Status != http.StatusCreated || controller.calls != 5 {
+		t.Errorf("Expected %d after %d calls, got %d after %d calls", http.StatusCreated, 5, ctx.Response.Status, controller.calls)
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	app := NewApplication()
+	controller := &ControllerIdempotencyTester{}
+	app.RegisterController("users", controller)
+	app.AddRoute(Route{Pattern: ":_controller"})
+	idempotency := NewIdempotency()
+	idempotency.MaxBodySize = 4
+	app.UseController("users", idempotency.Handle)
+
+	type testCase struct {
+		remoteAddr string
+		body       string
+		status     int
+		calls      int
+	}
+
+	testCases := []testCase{
+		{"10.0.0.1:1234", "john", http.StatusCreated, 1},
+		{"10.0.0.1:5678", "john", http.StatusCreated, 1},
+		{"10.0.0.2:1234", "john", http.StatusCreated, 2},
+		{"10.0.0.3:1234", "johnny", http.StatusRequestEntityTooLarge, 2},
+	}
+
+	for i, d := range testCases {
+		request, _ := http.NewRequest("POST", "/users", strings.NewReader(d.body))
+		request.RemoteAddr = d.remoteAddr
+		request.Header.Set("Idempotency-Key", "abc")
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != d.status {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.status, ctx.Response.Status)
+		}
+		if controller.calls != d.calls {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.calls, controller.calls)
+		}
+	}
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	app := NewApplication()
+	controller := &ControllerIdempotencyTester{}
+	app.RegisterController("users", controller)
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.UseController("users", func(ctx *Context, next func()) {
+		ctx.Response.Header.Set("Access-Control-Allow-Origin", ctx.Request.Header.Get("Origin"))
+		ctx.Response.Header.Set("RateLimit-Remaining", ctx.Request.Header.Get("X-Remaining"))
+		ctx.Response.Header.Set("Set-Cookie", "origin="+ctx.Request.Header.Get("Origin"))
+		next()
+	})
+	idempotency := NewIdempotency()
+	app.UseController("users", idempotency.Handle)
+
+	type testCase struct {
+		url       string
+		origin    string
+		remaining string
+		status    int
+		replayed  string
+	}
+
+	testCases := []testCase{
+		{"/users?notify=1", "https://a.example", "9", http.StatusCreated, ""},
+		{"/users?notify=1", "https://b.example", "8", http.StatusCreated, "true"},
+		{"/users?notify=0", "https://b.example", "7", http.StatusUnprocessableEntity, ""},
+	}
+
+	for i, d := range testCases {
+		request, _ := http.NewRequest("POST", d.url, strings.NewReader("john"))
+		request.Header.Set("Idempotency-Key", "abc")
+		request.Header.Set("Origin", d.origin)
+		request.Header.Set("X-Remaining", d.remaining)
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != d.status {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.status, ctx.Response.Status)
+		}
+		header := ctx.Response.Header
+		if header.Get("Idempotent-Replayed") != d.replayed {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.replayed, header.Get("Idempotent-Replayed"))
+		}
+		if header.Get("Access-Control-Allow-Origin") != d.origin {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.origin, header.Get("Access-Control-Allow-Origin"))
+		}
+		if header.Get("RateLimit-Remaining") != d.remaining {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.remaining, header.Get("RateLimit-Remaining"))
+		}
+		if header.Get("Set-Cookie") != "origin="+d.origin {
+			t.Errorf("Test %d: Expected %s, got %s", i, "origin="+d.origin, header.Get("Set-Cookie"))
+		}
+	}
+	if controller.calls != 1 {
+		t.Errorf("Expected %d, got %d", 1, controller.calls)
+	}
+
+	record, _ := idempotency.Store.Begin("ip::abc", "", time.Hour)
+	if record == nil || record.Header.Get("Location") != "/users/1" {
+		t.Fatalf("Expected a stored record, got %v", record)
+	}
+	for _, name := range []string{"Access-Control-Allow-Origin", "RateLimit-Remaining", "Set-Cookie", "X-Request-ID"} {
+		if record.Header.Get(name) != "" {
+			t.Errorf("Expected %s not to be stored, got %s", name, record.Header.Get(name))
+		}
+	}
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	app := NewApplication()
+	controller := &ControllerIdempotencyTester{started: make(chan bool), release: make(chan bool)}
+	app.RegisterController("users", controller)
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.UseController("users", NewIdempotency().Handle)
+
+	dispatch := func() *Context {
+		request, _ := http.NewRequest("POST", "/users", strings.NewReader("john"))
+		request.Header.Set("Idempotency-Key", "abc")
+		return app.Dispatch(request)
+	}
+
+	done := make(chan *Context)
+	go func() { done <- dispatch() }()
+	<-controller.started
+
+	ctx := dispatch()
+	if ctx.Response.Status != http.StatusConflict {
+		t.Errorf("Expected %d, got %d", http.StatusConflict, ctx.Response.Status)
+	}
+
+	controller.release <- true
+	ctx = <-done
+	if ctx.Response.Status != http.StatusCreated {
+		t.Errorf("Expected %d, got %d", http.StatusCreated, ctx.Response.Status)
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	store := NewMemoryIdempotencyStore()
+	store.now = func() time.Time { return now }
+
+	record, _ := store.Begin("a", "f1", time.Minute)
+	if record != nil {
+		t.Errorf("Expected no record, got %v", record)
+	}
+	record, _ = store.Begin("a", "f1", time.Minute)
+	if record == nil || record.Completed || record.Fingerprint != "f1" {
+		t.Errorf("Expected in-progress record, got %v", record)
+	}
+
+	store.Complete("a", &IdempotencyRecord{Fingerprint: "f1", Completed: true, Status: 201}, time.Minute)
+	record, _ = store.Begin("a", "f1", time.Minute)
+	if record == nil || record.Status != 201 {
+		t.Errorf("Expected completed record, got %v", record)
+	}
+
+	now = now.Add(2 * time.Minute)
+	record, _ = store.Begin("a", "f1", time.Minute)
+	if record != nil {
+		t.Errorf("Expected record to have expired, got %v", record)
+	}
+
+	store.Release("a")
+	record, _ = store.Begin("a", "f1", time.Minute)
+	if record != nil {
+		t.Errorf("Expected record to have been released, got %v", record)
+	}
+}
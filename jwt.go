@@ -0,0 +1,488 @@
+package ripple
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The errors returned when a JWT token cannot be verified.
+var (
+	ErrJwtMalformed        = errors.New("malformed token")
+	ErrJwtAlgorithm        = errors.New("unsupported token algorithm")
+	ErrJwtUnknownKey       = errors.New("unknown token key")
+	ErrJwtInvalidSignature = errors.New("invalid token signature")
+	ErrJwtExpired          = errors.New("token has expired")
+	ErrJwtNotYetValid      = errors.New("token is not valid yet")
+	ErrJwtInvalidIssuer    = errors.New("invalid token issuer")
+	ErrJwtInvalidAudience  = errors.New("invalid token audience")
+)
+
+// Provides the keys used to verify the JWT signatures.
+type JwtKeyProvider interface {
+	// Returns the key identified by kid (which may be empty if the token does
+	// not specify one). The key is a []byte for HS256, a *rsa.PublicKey for
+	// RS256 and a *ecdsa.PublicKey for ES256.
+	JwtKey(kid string) (interface{}, error)
+}
+
+// A static set of keys, indexed by key ID. The key with an empty ID is
+// used for the tokens that do not specify a key ID.
+type JwtKeys map[string]interface{}
+
+// Implementation of JwtKeyProvider.
+func (this JwtKeys) JwtKey(kid string) (interface{}, error) {
+	key, ok := this[kid]
+	if !ok {
+		return nil, ErrJwtUnknownKey
+	}
+	return key, nil
+}
+
+// Authenticates the requests using JWT Bearer tokens. The signature is checked
+// using HS256, RS256 or ES256, then the exp, nbf, iss and aud claims are
+// verified. The principal's Name is set to the "sub" claim, its Roles to the
+// "roles" claim, its Scopes to the "scope" or "scp" claim, and its Claims to
+// all the claims of the token.
+type JwtAuthenticator struct {
+	Realm string
+	// Provides the verification keys. See JwtKeys and JwksFile.
+	Keys JwtKeyProvider
+	// If not empty, the "iss" claim must be equal to this value.
+	Issuer string
+	// If not empty, the "aud" claim must contain this value.
+	Audience string
+	// The tolerance when checking the "exp" and "nbf" claims, to account for
+	// clock differences between servers.
+	ClockSkew time.Duration
+	// Returns the current time. Can be replaced for testing purposes.
+	Now func() time.Time
+}
+
+// Build a new JWT authenticator.
+func NewJwtAuthenticator(realm string, keys JwtKeyProvider) *JwtAuthenticator {
+	output := new(JwtAuthenticator)
+	output.Realm = realm
+	output.Keys = keys
+	output.ClockSkew = time.Minute
+	output.Now = time.Now
+	return output
+}
+
+// Implementation of Authenticator.
+func (this *JwtAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	if !hasAuthorizationScheme(request, "Bearer") {
+		return nil, nil
+	}
+	token := strings.TrimSpace(request.Header.Get("Authorization")[len("Bearer"):])
+	claims, err := this.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	output := new(Principal)
+	output.Name, _ = claims["sub"].(string)
+	output.Roles = jwtStringList(claims["roles"])
+	output.Scopes = jwtStringList(claims["scope"])
+	if output.Scopes == nil {
+		output.Scopes = jwtStringList(claims["scp"])
+	}
+	output.Claims = claims
+	return output, nil
+}
+
+// Converts a claim that is either a space-separated string (as the OAuth
+// "scope" claim) or an array of strings.
+func jwtStringList(v interface{}) []string {
+	var output []string
+	switch v.(type) {
+	case string:
+		output = strings.Fields(v.(string))
+	case []interface{}:
+		for _, e := range v.([]interface{}) {
+			if s, ok := e.(string); ok {
+				output = append(output, s)
+			}
+		}
+	}
+	return output
+}
+
+// Implementation of Authenticator.
+func (this *JwtAuthenticator) Challenge(err error) string {
+	if err != nil {
+		return fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\"", this.Realm)
+	}
+	return fmt.Sprintf("Bearer realm=%q", this.Realm)
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verifies the token and returns its claims.
+func (this *JwtAuthenticator) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJwtMalformed
+	}
+
+	var header jwtHeader
+	err := decodeJwtPart(parts[0], &header)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJwtMalformed
+	}
+	key, err := this.Keys.JwtKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyJwtSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	err = decodeJwtPart(parts[1], &claims)
+	if err != nil {
+		return nil, err
+	}
+	err = this.verifyClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (this *JwtAuthenticator) verifyClaims(claims map[string]interface{}) error {
+	now := this.Now()
+
+	if exp, ok := claims["exp"]; ok {
+		t, ok := jwtNumericDate(exp)
+		if !ok {
+			return ErrJwtMalformed
+		}
+		if !now.Before(t.Add(this.ClockSkew)) {
+			return ErrJwtExpired
+		}
+	}
+
+	if nbf, ok := claims["nbf"]; ok {
+		t, ok := jwtNumericDate(nbf)
+		if !ok {
+			return ErrJwtMalformed
+		}
+		if now.Add(this.ClockSkew).Before(t) {
+			return ErrJwtNotYetValid
+		}
+	}
+
+	if this.Issuer != "" {
+		iss, _ := claims["iss"].(string)
+		if iss != this.Issuer {
+			return ErrJwtInvalidIssuer
+		}
+	}
+
+	if this.Audience != "" && !jwtHasAudience(claims["aud"], this.Audience) {
+		return ErrJwtInvalidAudience
+	}
+
+	return nil
+}
+
+func jwtNumericDate(v interface{}) (time.Time, bool) {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+// The "aud" claim can either be a string or an array of strings.
+func jwtHasAudience(aud interface{}, audience string) bool {
+	switch aud.(type) {
+	case string:
+		return aud.(string) == audience
+	case []interface{}:
+		for _, a := range aud.([]interface{}) {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeJwtPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return ErrJwtMalformed
+	}
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return ErrJwtMalformed
+	}
+	return nil
+}
+
+// Checks the signature. The type of the key must match the algorithm, so
+// that, for instance, an RSA public key cannot be used as an HMAC secret.
+func verifyJwtSignature(alg string, key interface{}, signed []byte, signature []byte) error {
+	hash := sha256.Sum256(signed)
+
+	switch alg {
+
+	case "HS256":
+
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrJwtAlgorithm
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrJwtInvalidSignature
+		}
+
+	case "RS256":
+
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrJwtAlgorithm
+		}
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature) != nil {
+			return ErrJwtInvalidSignature
+		}
+
+	case "ES256":
+
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || publicKey.Curve != elliptic.P256() {
+			return ErrJwtAlgorithm
+		}
+		if len(signature) != 64 {
+			return ErrJwtInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[0:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(publicKey, hash[:], r, s) {
+			return ErrJwtInvalidSignature
+		}
+
+	default:
+
+		return ErrJwtAlgorithm
+
+	}
+
+	return nil
+}
+
+// Provides the keys of a local JWKS file (JSON Web Key Set, RFC 7517).
+// The file is reloaded when it changes, so keys can be rotated without
+// restarting the application: when a token refers to an unknown key ID,
+// or at most every CheckInterval, the modification time of the file is
+// checked and, if it has changed, the keys are loaded again.
+type JwksFile struct {
+	Path string
+	// How often the file is checked for changes (default to one minute).
+	CheckInterval time.Duration
+	// The minimum time between two checks caused by unknown key IDs (default
+	// to one second), so that tokens with random key IDs cannot cause a file
+	// system access for every request.
+	UnknownKeyInterval time.Duration
+	mutex              sync.Mutex
+	keys               JwtKeys
+	modTime            time.Time
+	lastCheck          time.Time
+	now                func() time.Time
+}
+
+// Build a new JWKS file object and loads its keys.
+func NewJwksFile(path string) (*JwksFile, error) {
+	output := new(JwksFile)
+	output.Path = path
+	output.CheckInterval = time.Minute
+	output.UnknownKeyInterval = time.Second
+	output.now = time.Now
+	err := output.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// Loads the keys from the file.
+func (this *JwksFile) Reload() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.reload()
+}
+
+func (this *JwksFile) reload() error {
+	this.lastCheck = this.currentTime()
+	info, err := os.Stat(this.Path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(this.Path)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseJwks(b)
+	if err != nil {
+		return err
+	}
+	this.keys = keys
+	this.modTime = info.ModTime()
+	return nil
+}
+
+func (this *JwksFile) currentTime() time.Time {
+	if this.now == nil {
+		return time.Now()
+	}
+	return this.now()
+}
+
+// Implementation of JwtKeyProvider.
+func (this *JwksFile) JwtKey(kid string) (interface{}, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	key, ok := this.keys[kid]
+	elapsed := this.currentTime().Sub(this.lastCheck)
+	if (!ok && elapsed >= this.UnknownKeyInterval) || elapsed >= this.CheckInterval {
+		this.lastCheck = this.currentTime()
+		info, err := os.Stat(this.Path)
+		if err == nil && !info.ModTime().Equal(this.modTime) {
+			err = this.reload()
+			// Keep the previous keys, in case the file is being written or
+			// has been replaced by an invalid one, and only fail for the
+			// keys that are not among them.
+			if _, known := this.keys[kid]; err != nil && !known {
+				return nil, err
+			}
+		}
+		key, ok = this.keys[kid]
+	}
+	if !ok {
+		return nil, ErrJwtUnknownKey
+	}
+	return key, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Parses a JSON Web Key Set. RSA, EC (P-256) and symmetric ("oct") keys are
+// supported; other keys and the keys not meant for signatures are ignored.
+// If the set contains a single key, it is also used for the tokens that do
+// not specify a key ID.
+func ParseJwks(data []byte) (JwtKeys, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&set)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(JwtKeys)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key \"%s\": %s", k.Kid, err)
+		}
+		if key != nil {
+			output[k.Kid] = key
+		}
+	}
+	if len(set.Keys) == 1 {
+		if key, ok := output[set.Keys[0].Kid]; ok {
+			output[""] = key
+		}
+	}
+	return output, nil
+}
+
+func (this *jwk) publicKey() (interface{}, error) {
+	switch this.Kty {
+
+	case "oct":
+
+		return base64.RawURLEncoding.DecodeString(this.K)
+
+	case "RSA":
+
+		n, err := decodeJwkInt(this.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJwkInt(this.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+
+		if this.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeJwkInt(this.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJwkInt(this.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+
+	}
+
+	return nil, nil
+}
+
+func decodeJwkInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,184 @@
+package ripple
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func makeTestJwt(t *testing.T, alg string, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, hash[:])
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[0:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJwtVerify(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	now := time.Unix(1500000000, 0)
+	auth := NewJwtAuthenticator("test", JwtKeys{"hs": secret, "rs": &rsaKey.PublicKey, "es": &ecKey.PublicKey})
+	auth.Issuer = "issuer"
+	auth.Audience = "api"
+	auth.ClockSkew = 30 * time.Second
+	auth.Now = func() time.Time { return now }
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		output := map[string]interface{}{"sub": "john", "iss": "issuer", "aud": "api", "exp": now.Unix() + 60}
+		for k, v := range extra {
+			output[k] = v
+		}
+		return output
+	}
+
+	type JwtTest struct {
+		token    string
+		expected error
+	}
+	var jwtTests = []JwtTest{
+		{makeTestJwt(t, "HS256", "hs", secret, claims(nil)), nil},
+		{makeTestJwt(t, "RS256", "rs", rsaKey, claims(nil)), nil},
+		{makeTestJwt(t, "ES256", "es", ecKey, claims(nil)), nil},
+		{makeTestJwt(t, "HS256", "hs", []byte("wrong"), claims(nil)), ErrJwtInvalidSignature},
+		{makeTestJwt(t, "HS256", "rs", secret, claims(nil)), ErrJwtAlgorithm},
+		{makeTestJwt(t, "none", "hs", secret, claims(nil)), ErrJwtAlgorithm},
+		{makeTestJwt(t, "HS256", "nope", secret, claims(nil)), ErrJwtUnknownKey},
+		{makeTestJwt(t, "HS256", "hs", secret, claims(map[string]interface{}{"exp": now.Unix() - 20})), nil},
+		{makeTestJwt(t, "HS256", "hs", secret, claims(map[string]interface{}{"exp": now.Unix() - 40})), ErrJwtExpired},
+		{makeTestJwt(t, "HS256", "hs", secret, claims(map[string]interface{}{"nbf": now.Unix() + 20})), nil},
+		{makeTestJwt(t, "HS256", "hs", secret, claims(map[string]interface{}{"nbf": now.Unix() + 40})), ErrJwtNotYetValid},
+		{makeTestJwt(t, "HS256", "hs", secret, claims(map[string]interface{}{"iss": "other"})), ErrJwtInvalidIssuer},
+		{makeTestJwt(t, "HS256", "hs", secret, claims(map[string]interface{}{"aud": []string{"other", "api"}})), nil},
+		{makeTestJwt(t, "HS256", "hs", secret, claims(map[string]interface{}{"aud": "other"})), ErrJwtInvalidAudience},
+		{"abcd.efgh", ErrJwtMalformed},
+	}
+	for i, d := range jwtTests {
+		_, err := auth.Verify(d.token)
+		if err != d.expected {
+			t.Errorf("Test %d: Expected %v, got %v", i, d.expected, err)
+		}
+	}
+
+	var reader io.Reader
+	request, _ := http.NewRequest("GET", "/", reader)
+	request.Header.Set("Authorization", "Bearer "+makeTestJwt(t, "ES256", "es", ecKey, claims(map[string]interface{}{"role": "admin"})))
+	principal, err := auth.Authenticate(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Name != "john" || principal.Claims["role"] != "admin" {
+		t.Errorf("Unexpected principal: %v", principal)
+	}
+}
+
+func writeTestJwks(t *testing.T, path string, kid string, key *rsa.PublicKey, modTime time.Time) {
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	b, _ := json.Marshal(jwks)
+	err := os.WriteFile(path, b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, modTime, modTime)
+}
+
+func TestJwksFile(t *testing.T) {
+	key1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJwks(t, path, "key1", &key1.PublicKey, time.Now().Add(-time.Hour))
+
+	jwks, err := NewJwksFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	jwks.now = func() time.Time { return now }
+	auth := NewJwtAuthenticator("test", jwks)
+	claims := map[string]interface{}{"sub": "john"}
+
+	_, err = auth.Verify(makeTestJwt(t, "RS256", "key1", key1, claims))
+	if err != nil {
+		t.Errorf("Expected success, got %s", err)
+	}
+	_, err = auth.Verify(makeTestJwt(t, "RS256", "key2", key2, claims))
+	if err != ErrJwtUnknownKey {
+		t.Errorf("Expected %s, got %v", ErrJwtUnknownKey, err)
+	}
+
+	writeTestJwks(t, path, "key2", &key2.PublicKey, time.Now())
+
+	// Unknown key IDs do not check the file more than once per second.
+	_, err = auth.Verify(makeTestJwt(t, "RS256", "key2", key2, claims))
+	if err != ErrJwtUnknownKey {
+		t.Errorf("Expected %s before the reload interval, got %v", ErrJwtUnknownKey, err)
+	}
+
+	now = now.Add(time.Second)
+	_, err = auth.Verify(makeTestJwt(t, "RS256", "key2", key2, claims))
+	if err != nil {
+		t.Errorf("Expected success after rotation, got %s", err)
+	}
+	_, err = auth.Verify(makeTestJwt(t, "RS256", "key1", key1, claims))
+	if err != ErrJwtUnknownKey {
+		t.Errorf("Expected %s, got %v", ErrJwtUnknownKey, err)
+	}
+
+	// While the file is invalid, the previous keys are still used.
+	err = os.WriteFile(path, []byte("{\"keys\": ["), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	now = now.Add(time.Minute)
+	_, err = auth.Verify(makeTestJwt(t, "RS256", "key2", key2, claims))
+	if err != nil {
+		t.Errorf("Expected success with the previous keys, got %s", err)
+	}
+	now = now.Add(time.Second)
+	_, err = auth.Verify(makeTestJwt(t, "RS256", "key1", key1, claims))
+	if err == nil || err == ErrJwtUnknownKey {
+		t.Errorf("Expected the reload error, got %v", err)
+	}
+}
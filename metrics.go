@@ -0,0 +1,428 @@
+package ripple
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// The labels of the request metrics.
+var requestMetricLabels = []string{"route", "controller", "action", "method", "status"}
+
+type metricsKey struct{}
+
+// Collects metrics about the requests and serves them in the Prometheus text
+// format. For each matched route, controller, action, request method and
+// status class ("2xx", "4xx", etc.), it records:
+//
+//   - <namespace>_requests_total: the number of requests.
+//   - <namespace>_request_duration_seconds: a histogram of the time spent in
+//     the middlewares and action. For streamed responses, it does not include
+//     the time spent sending the body.
+//   - <namespace>_response_size_bytes: a histogram of the size of the
+//     response bodies, before compression.
+//
+// The requests that match no route all have empty route, controller and
+// action labels, so that invalid URLs cannot create new series. The requests
+// are recorded once their response has been serialized by ServeHTTP(), so the
+// requests that are only dispatched are not recorded. Add it before the
+// other middlewares to measure them too:
+//
+//	metrics := ripple.NewMetrics()
+//	app.Use(metrics.Handle)
+type Metrics struct {
+	// The path of the metrics endpoint (default to "/metrics"), relative to
+	// the base URL. If empty, the metrics are not served, but they can still be
+	// written with Write().
+	Path string
+	// The prefix of the request metrics (default to "ripple").
+	Namespace string
+	// The upper bounds of the duration buckets, in seconds.
+	DurationBuckets []float64
+	// The upper bounds of the size buckets, in bytes.
+	SizeBuckets []float64
+
+	mutex    sync.Mutex
+	series   map[string]*requestSeries
+	counters map[string]*Counter
+}
+
+type requestSeries struct {
+	labels   []string
+	duration *histogram
+	size     *histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Build a new metrics collector.
+func NewMetrics() *Metrics {
+	output := new(Metrics)
+	output.Path = "/metrics"
+	output.Namespace = "ripple"
+	output.DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	output.SizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+	output.series = make(map[string]*requestSeries)
+	output.counters = make(map[string]*Counter)
+	return output
+}
+
+// Implementation of Middleware.
+func (this *Metrics) Handle(ctx *Context, next func()) {
+	if this.Path != "" && (ctx.Request.Method == "GET" || ctx.Request.Method == "HEAD") && this.isMetricsPath(ctx) {
+		var output strings.Builder
+		this.Write(&output)
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		ctx.Response.Header.Set("Cache-Control", "no-store")
+		ctx.Response.Body = output.String()
+		return
+	}
+
+	start := time.Now()
+	ctx.Set(metricsKey{}, this)
+	next()
+	duration := time.Since(start)
+
+	observe := func(status int, size int) {
+		series := this.findSeries(ctx, status)
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		series.duration.observe(this.DurationBuckets, duration.Seconds())
+		if size >= 0 {
+			series.size.observe(this.SizeBuckets, float64(size))
+		}
+	}
+
+	stream, isStream := ctx.Response.Body.(io.Reader)
+	if !isStream {
+		if ctx.Application() == nil {
+			observe(ctx.Response.Status, 0)
+			return
+		}
+		// The body is measured when it is serialized, which may also change
+		// the status if it fails.
+		ctx.onSerialized(observe)
+		return
+	}
+
+	// The size of a streamed body is only known once it has been sent.
+	observe(ctx.Response.Status, -1)
+	series := this.findSeries(ctx, ctx.Response.Status)
+	ctx.Response.Body = &metricsCountingReader{reader: stream, onClose: func(n int) {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		series.size.observe(this.SizeBuckets, float64(n))
+	}}
+}
+
+func (this *Metrics) isMetricsPath(ctx *Context) bool {
+	if ctx.Application() == nil {
+		return ctx.Request.URL.Path == this.Path
+	}
+	tokens, _, ok := ctx.Application().requestPathTokens(ctx.Request.URL)
+	return ok && "/"+strings.Join(tokens, "/") == "/"+strings.Trim(this.Path, "/")
+}
+
+// Returns the series of the request, creating it if needed.
+func (this *Metrics) findSeries(ctx *Context, status int) *requestSeries {
+	match := ctx.Match()
+	labels := []string{"", "", "", ctx.Request.Method, "2xx"}
+	if match.Success {
+		labels[0] = match.MatchedRoute.Pattern
+		labels[1] = match.ControllerName
+		labels[2] = match.ActionName
+	} else if !containsString(standardMethods, ctx.Request.Method) {
+		// The method is sent by the client, so the unknown ones are grouped.
+		labels[3] = "OTHER"
+	}
+	if status > 0 {
+		labels[4] = strconv.Itoa(status/100) + "xx"
+	}
+
+	key := strings.Join(labels, "\xff")
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	output, ok := this.series[key]
+	if !ok {
+		output = &requestSeries{labels, newHistogram(this.DurationBuckets), newHistogram(this.SizeBuckets)}
+		this.series[key] = output
+	}
+	return output
+}
+
+// Returns the counter with the given name, creating it if needed. The name
+// must be a valid Prometheus metric name, for example "emails_sent_total".
+// Calling it again with the same name returns the same counter. Panics if
+// the name or labels are invalid, or if the counter already exists with
+// different labels. On a nil Metrics, returns a nil counter, which ignores
+// all increments, so that controllers can record metrics even when they are
+// not collected:
+//
+//	ctx.Metrics().Counter("emails_sent_total", "Number of emails sent.", "template").Inc("welcome")
+func (this *Metrics) Counter(name string, help string, labelNames ...string) *Counter {
+	if this == nil {
+		return nil
+	}
+	if !metricNameRegexp.MatchString(name) {
+		log.Panicf("Invalid metric name: %s", name)
+	}
+	for _, labelName := range labelNames {
+		if !labelNameRegexp.MatchString(labelName) || strings.HasPrefix(labelName, "__") {
+			log.Panicf("Invalid label name: %s", labelName)
+		}
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if output, ok := this.counters[name]; ok {
+		if strings.Join(output.labelNames, ",") != strings.Join(labelNames, ",") {
+			log.Panicf("Counter %s already exists with labels %v", name, output.labelNames)
+		}
+		return output
+	}
+	output := new(Counter)
+	output.name = name
+	output.help = help
+	output.labelNames = append([]string(nil), labelNames...)
+	output.values = make(map[string]*counterValue)
+	this.counters[name] = output
+	return output
+}
+
+// Returns the metrics collector handling the request, or nil if there is
+// none. See Metrics.Counter().
+func (this *Context) Metrics() *Metrics {
+	output, _ := this.Value(metricsKey{}).(*Metrics)
+	return output
+}
+
+// Writes all the metrics in the Prometheus text exposition format.
+func (this *Metrics) Write(w io.Writer) error {
+	this.mutex.Lock()
+	var series []*requestSeries
+	for _, s := range this.series {
+		series = append(series, &requestSeries{s.labels, s.duration.clone(), s.size.clone()})
+	}
+	var counters []*Counter
+	for _, counter := range this.counters {
+		counters = append(counters, counter)
+	}
+	this.mutex.Unlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].labels, "\xff") < strings.Join(series[j].labels, "\xff")
+	})
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i].name < counters[j].name
+	})
+
+	var b strings.Builder
+	name := this.Namespace + "_requests_total"
+	writeMetricHeader(&b, name, "Total number of HTTP requests.", "counter")
+	for _, s := range series {
+		b.WriteString(name + formatLabels(requestMetricLabels, s.labels, "", "") + " " + strconv.FormatUint(s.duration.count, 10) + "\n")
+	}
+	this.writeHistograms(&b, this.Namespace+"_request_duration_seconds", "Duration of the HTTP requests in seconds.", this.DurationBuckets, series, func(s *requestSeries) *histogram {
+		return s.duration
+	})
+	this.writeHistograms(&b, this.Namespace+"_response_size_bytes", "Size of the HTTP response bodies in bytes.", this.SizeBuckets, series, func(s *requestSeries) *histogram {
+		return s.size
+	})
+	for _, counter := range counters {
+		counter.write(&b)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (this *Metrics) writeHistograms(b *strings.Builder, name string, help string, buckets []float64, series []*requestSeries, get func(s *requestSeries) *histogram) {
+	writeMetricHeader(b, name, help, "histogram")
+	for _, s := range series {
+		h := get(s)
+		if h.count == 0 {
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range buckets {
+			cumulative += h.counts[i]
+			b.WriteString(name + "_bucket" + formatLabels(requestMetricLabels, s.labels, "le", formatMetricValue(bound)) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		b.WriteString(name + "_bucket" + formatLabels(requestMetricLabels, s.labels, "le", "+Inf") + " " + strconv.FormatUint(h.count, 10) + "\n")
+		b.WriteString(name + "_sum" + formatLabels(requestMetricLabels, s.labels, "", "") + " " + formatMetricValue(h.sum) + "\n")
+		b.WriteString(name + "_count" + formatLabels(requestMetricLabels, s.labels, "", "") + " " + strconv.FormatUint(h.count, 10) + "\n")
+	}
+}
+
+func newHistogram(buckets []float64) *histogram {
+	output := new(histogram)
+	output.counts = make([]uint64, len(buckets))
+	return output
+}
+
+// Records a value. The counts are per bucket, and made cumulative when they
+// are written.
+func (this *histogram) observe(buckets []float64, value float64) {
+	this.count++
+	this.sum += value
+	for i, bound := range buckets {
+		if value <= bound {
+			this.counts[i]++
+			return
+		}
+	}
+}
+
+func (this *histogram) clone() *histogram {
+	output := *this
+	output.counts = append([]uint64(nil), this.counts...)
+	return &output
+}
+
+// A metric that can only increase, such as a number of events. Build it with
+// Metrics.Counter().
+type Counter struct {
+	name       string
+	help       string
+	labelNames []string
+	mutex      sync.Mutex
+	values     map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// Increments the counter by 1. The label values are given in the order of the
+// label names of the counter.
+func (this *Counter) Inc(labelValues ...string) {
+	this.Add(1, labelValues...)
+}
+
+// Adds the value, which must not be negative, to the counter. Panics if the
+// number of label values does not match the label names.
+func (this *Counter) Add(value float64, labelValues ...string) {
+	if this == nil {
+		return
+	}
+	if len(labelValues) != len(this.labelNames) {
+		log.Panicf("Counter %s expects %d label values, got %d", this.name, len(this.labelNames), len(labelValues))
+	}
+	if value < 0 || math.IsNaN(value) {
+		log.Panicf("Counter %s cannot be decreased", this.name)
+	}
+	key := strings.Join(labelValues, "\xff")
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	v, ok := this.values[key]
+	if !ok {
+		v = &counterValue{labels: append([]string(nil), labelValues...)}
+		this.values[key] = v
+	}
+	v.value += value
+}
+
+// Returns the current value of the counter for the given label values.
+func (this *Counter) Value(labelValues ...string) float64 {
+	if this == nil {
+		return 0
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if v, ok := this.values[strings.Join(labelValues, "\xff")]; ok {
+		return v.value
+	}
+	return 0
+}
+
+func (this *Counter) write(b *strings.Builder) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	var keys []string
+	for key := range this.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writeMetricHeader(b, this.name, this.help, "counter")
+	for _, key := range keys {
+		v := this.values[key]
+		b.WriteString(this.name + formatLabels(this.labelNames, v.labels, "", "") + " " + formatMetricValue(v.value) + "\n")
+	}
+}
+
+func writeMetricHeader(b *strings.Builder, name string, help string, metricType string) {
+	if help != "" {
+		help = strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(help)
+		b.WriteString("# HELP " + name + " " + help + "\n")
+	}
+	b.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+// Returns the labels in the "{name="value",...}" format, with an optional
+// extra label, or an empty string if there are no labels.
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	var pairs []string
+	escaper := strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escaper.Replace(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	if math.IsInf(v, -1) {
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counts the bytes read from a streamed body, and reports them when the body
+// is closed.
+type metricsCountingReader struct {
+	reader  io.Reader
+	n       int
+	onClose func(n int)
+}
+
+func (this *metricsCountingReader) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	this.n += n
+	return n, err
+}
+
+func (this *metricsCountingReader) Close() error {
+	if this.onClose != nil {
+		this.onClose(this.n)
+	}
+	if closer, ok := this.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
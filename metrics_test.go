@@ -0,0 +1,173 @@
+package ripple
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type ControllerMetricsTester struct{}
+
+func (this *ControllerMetricsTester) Get(ctx *Context) {
+	ctx.Metrics().Counter("emails_sent_total", "Number of emails sent.", "template").Inc("welcome")
+	ctx.Response.Body = "0123456789"
+}
+
+func (this *ControllerMetricsTester) Post(ctx *Context) {
+	ctx.Response.Body = map[string]string{"Id": "1"}
+}
+
+func (this *ControllerMetricsTester) GetCount(ctx *Context) {
+	ctx.Response.Body = &metricsMarshalCounter{}
+}
+
+func (this *ControllerMetricsTester) GetStream(ctx *Context) {
+	ctx.Response.Body = strings.NewReader(strings.Repeat("a", 500))
+}
+
+type metricsMarshalCounter struct {
+	calls int
+}
+
+func (this *metricsMarshalCounter) MarshalJSON() ([]byte, error) {
+	this.calls++
+	return []byte("\"counted\""), nil
+}
+
+func TestMetricsSerializeOnce(t *testing.T) {
+	app := NewApplication()
+	metrics := NewMetrics()
+	app.Use(metrics.Handle)
+	app.RegisterController("users", &ControllerMetricsTester{})
+	app.AddRoute(Route{Pattern: ":_controller/:_action"})
+
+	ctx := app.Dispatch(httptest.NewRequest("GET", "/users/count", nil))
+	body := ctx.Response.Body.(*metricsMarshalCounter)
+	app.prepareServeHttpResponseData(ctx)
+	if body.calls != 1 {
+		t.Errorf("Expected %d, got %d", 1, body.calls)
+	}
+
+	var b strings.Builder
+	metrics.Write(&b)
+	expected := `ripple_response_size_bytes_sum{route=":_controller/:_action",controller="users",action="count",method="GET",status="2xx"} 9`
+	if !strings.Contains(b.String(), expected+"\n") {
+		t.Errorf("Expected %s, got %s", expected, b.String())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	app := NewApplication()
+	app.SetBaseUrl("/api/")
+	metrics := NewMetrics()
+	metrics.DurationBuckets = []float64{60}
+	app.Use(metrics.Handle)
+	app.RegisterController("users", &ControllerMetricsTester{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+	app.AddRoute(Route{Pattern: "users/:id/stream", Controller: "users", Action: "stream"})
+
+	requests := []struct {
+		method string
+		url    string
+	}{
+		{"GET", "/api/users/1"},
+		{"GET", "/api/users/2"},
+		{"POST", "/api/users"},
+		{"GET", "/api/nope"},
+		{"BREW", "/api/nope"},
+		{"GET", "/api/users/1/stream"},
+	}
+	for _, r := range requests {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(r.method, r.url, nil))
+	}
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if recorder.Header().Get("Content-Type") != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Expected %s, got %s", "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	}
+
+	body := recorder.Body.String()
+	expected := []string{
+		"# HELP ripple_requests_total Total number of HTTP requests.",
+		"# TYPE ripple_requests_total counter",
+		`ripple_requests_total{route="",controller="",action="",method="GET",status="4xx"} 1`,
+		`ripple_requests_total{route="",controller="",action="",method="OTHER",status="4xx"} 1`,
+		`ripple_requests_total{route=":_controller",controller="users",action="",method="POST",status="2xx"} 1`,
+		`ripple_requests_total{route=":_controller/:id",controller="users",action="",method="GET",status="2xx"} 2`,
+		`ripple_requests_total{route="users/:id/stream",controller="users",action="stream",method="GET",status="2xx"} 1`,
+		"# TYPE ripple_request_duration_seconds histogram",
+		`ripple_request_duration_seconds_bucket{route=":_controller/:id",controller="users",action="",method="GET",status="2xx",le="60"} 2`,
+		`ripple_request_duration_seconds_bucket{route=":_controller/:id",controller="users",action="",method="GET",status="2xx",le="+Inf"} 2`,
+		`ripple_request_duration_seconds_count{route=":_controller/:id",controller="users",action="",method="GET",status="2xx"} 2`,
+		"# TYPE ripple_response_size_bytes histogram",
+		`ripple_response_size_bytes_bucket{route=":_controller/:id",controller="users",action="",method="GET",status="2xx",le="100"} 2`,
+		`ripple_response_size_bytes_sum{route=":_controller/:id",controller="users",action="",method="GET",status="2xx"} 20`,
+		`ripple_response_size_bytes_sum{route=":_controller",controller="users",action="",method="POST",status="2xx"} 10`,
+		`ripple_response_size_bytes_bucket{route="users/:id/stream",controller="users",action="stream",method="GET",status="2xx",le="100"} 0`,
+		`ripple_response_size_bytes_bucket{route="users/:id/stream",controller="users",action="stream",method="GET",status="2xx",le="1000"} 1`,
+		"# HELP emails_sent_total Number of emails sent.",
+		"# TYPE emails_sent_total counter",
+		`emails_sent_total{template="welcome"} 2`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected %s, got %s", line, body)
+		}
+	}
+	if strings.Contains(body, "metrics") {
+		t.Errorf("Expected the metrics endpoint not to be measured, got %s", body)
+	}
+}
+
+func TestMetricsCounter(t *testing.T) {
+	metrics := NewMetrics()
+	counter := metrics.Counter("jobs_total", "", "queue", "result")
+	counter.Inc("default", "ok")
+	counter.Add(2.5, "default", "ok")
+	metrics.Counter("jobs_total", "", "queue", "result").Inc("a\"b\\c\nd", "failed")
+
+	if counter.Value("default", "ok") != 3.5 {
+		t.Errorf("Expected %f, got %f", 3.5, counter.Value("default", "ok"))
+	}
+
+	var b strings.Builder
+	metrics.Write(&b)
+	expected := "# TYPE jobs_total counter\n" +
+		"jobs_total{queue=\"a\\\"b\\\\c\\nd\",result=\"failed\"} 1\n" +
+		"jobs_total{queue=\"default\",result=\"ok\"} 3.5\n"
+	if !strings.HasSuffix(b.String(), expected) {
+		t.Errorf("Expected %s, got %s", expected, b.String())
+	}
+
+	// A nil collector, as returned by Context.Metrics() when the metrics are
+	// not collected, ignores the increments.
+	var none *Metrics
+	none.Counter("jobs_total", "").Inc()
+	if none.Counter("jobs_total", "").Value() != 0 {
+		t.Errorf("Expected a nil counter to be empty")
+	}
+
+	panics := []func(){
+		func() { metrics.Counter("invalid-name", "") },
+		func() { metrics.Counter("valid", "", "__reserved") },
+		func() { metrics.Counter("jobs_total", "", "queue") },
+		func() { counter.Inc("default") },
+		func() { counter.Add(-1, "default", "ok") },
+	}
+	for i, f := range panics {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Test %d: Expected a panic", i)
+				}
+			}()
+			f()
+		}()
+	}
+}
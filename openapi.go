@@ -0,0 +1,448 @@
+package ripple
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Describes an action in the OpenAPI document.
+type OpenAPIOperation struct {
+	Summary     string
+	Description string
+	// A value whose type describes the request body, such as UserModel{}.
+	Request interface{}
+	// A value whose type describes the response body, such as []UserModel{}.
+	Response   interface{}
+	Deprecated bool
+}
+
+// Implemented by the controllers that document their actions. For example:
+//
+//	func (this *UserController) OpenAPIOperations() map[string]ripple.OpenAPIOperation {
+//		return map[string]ripple.OpenAPIOperation{
+//			"Get":  {Summary: "Get a user", Response: UserModel{}},
+//			"Post": {Summary: "Create a user", Request: UserModel{}, Response: UserModel{}},
+//		}
+//	}
+type OpenAPIProvider interface {
+	// Returns the operations indexed by method name, such as "Get" or
+	// "PostFriends".
+	OpenAPIOperations() map[string]OpenAPIOperation
+}
+
+// An OpenAPI document, as built by Application.OpenAPI(). It can be modified
+// before being serialized, for example to set the title of the API:
+//
+//	doc := app.OpenAPI()
+//	doc["info"] = map[string]interface{}{"title": "Users API", "version": "2.0.0"}
+type OpenAPIDocument map[string]interface{}
+
+// Builds an OpenAPI 3.1 document that describes the actions reachable through
+// the routes of the application. The ":_controller" and ":_action" tokens of
+// the route patterns are expanded against the registered controllers, and the
+// other ":name" tokens become path parameters. The request and response
+// schemas are taken from the controllers that implement OpenAPIProvider.
+func (this *Application) OpenAPI() OpenAPIDocument {
+	schemas := newOpenAPISchemas()
+	errorSchema := schemas.schema(reflect.TypeOf(ErrorBody{}))
+
+	paths := make(map[string]interface{})
+	for _, entry := range this.Routes() {
+		path := openAPIPath(entry.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+
+		var operations map[string]OpenAPIOperation
+		if provider, ok := this.controllers[entry.Controller].(OpenAPIProvider); ok {
+			operations = provider.OpenAPIOperations()
+		}
+		info := operations[entry.MethodName]
+
+		operation := map[string]interface{}{
+			"operationId": entry.Controller + entry.MethodName,
+			"tags":        []string{entry.Controller},
+		}
+		if info.Summary != "" {
+			operation["summary"] = info.Summary
+		}
+		if info.Description != "" {
+			operation["description"] = info.Description
+		}
+		if info.Deprecated {
+			operation["deprecated"] = true
+		}
+
+		if len(entry.Params) > 0 {
+			var parameters []interface{}
+			for _, name := range entry.Params {
+				parameters = append(parameters, map[string]interface{}{
+					"name":     name,
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+				})
+			}
+			operation["parameters"] = parameters
+		}
+
+		if info.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  this.openAPIContent(schemas.schema(reflect.TypeOf(info.Request))),
+			}
+		}
+
+		status := defaultHttpStatus(entry.Method)
+		response := map[string]interface{}{"description": http.StatusText(status)}
+		if info.Response != nil {
+			response["content"] = this.openAPIContent(schemas.schema(reflect.TypeOf(info.Response)))
+		}
+		operation["responses"] = map[string]interface{}{
+			strconv.Itoa(status): response,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     this.openAPIContent(errorSchema),
+			},
+		}
+
+		paths[path].(map[string]interface{})[strings.ToLower(entry.Method)] = operation
+	}
+
+	output := OpenAPIDocument{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.schemas(),
+		},
+	}
+	basePath := strings.TrimSuffix(this.parsedBaseUrl.Path, "/")
+	if basePath != "" {
+		output["servers"] = []interface{}{map[string]interface{}{"url": basePath}}
+	}
+	return output
+}
+
+func (this *Application) openAPIContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		this.contentType: map[string]interface{}{"schema": schema},
+	}
+}
+
+var openAPIParamRegexp = regexp.MustCompile(`(^|/):([^/]+)`)
+
+// Converts the ":name" tokens of a path to the "{name}" syntax of OpenAPI.
+func openAPIPath(path string) string {
+	return openAPIParamRegexp.ReplaceAllString(path, "$1{$2}")
+}
+
+// Serializes the document to JSON.
+func (this OpenAPIDocument) JSON() ([]byte, error) {
+	return json.MarshalIndent(this, "", "  ")
+}
+
+// Serializes the document to YAML.
+func (this OpenAPIDocument) YAML() ([]byte, error) {
+	data, err := json.Marshal(this)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeJson(data)
+	if err != nil {
+		return nil, err
+	}
+	var output strings.Builder
+	writeYaml(&output, doc, 0)
+	return []byte(output.String()), nil
+}
+
+// Returns a middleware that serves the document in JSON at jsonPath and in
+// YAML at yamlPath. Either path can be empty. The paths are relative to the
+// base URL of the application, and are not subject to the controller routes:
+//
+//	app.Use(app.OpenAPI().Endpoint("/openapi.json", "/openapi.yaml"))
+func (this OpenAPIDocument) Endpoint(jsonPath string, yamlPath string) Middleware {
+	jsonData, jsonErr := this.JSON()
+	yamlData, yamlErr := this.YAML()
+	return func(ctx *Context, next func()) {
+		if ctx.Request.Method != "GET" && ctx.Request.Method != "HEAD" {
+			next()
+			return
+		}
+		path := ctx.Request.URL.Path
+		if ctx.Application() != nil {
+			basePath := strings.TrimSuffix(ctx.Application().parsedBaseUrl.Path, "/")
+			path = "/" + strings.TrimPrefix(strings.TrimPrefix(path, basePath), "/")
+		}
+
+		var data []byte
+		var err error
+		contentType := ""
+		if jsonPath != "" && path == jsonPath {
+			data, err, contentType = jsonData, jsonErr, "application/json"
+		} else if yamlPath != "" && path == yamlPath {
+			data, err, contentType = yamlData, yamlErr, "application/yaml"
+		} else {
+			next()
+			return
+		}
+		if err != nil {
+			ctx.Error(http.StatusInternalServerError, "")
+			return
+		}
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Header.Set("Content-Type", contentType)
+		ctx.Response.Body = string(data)
+	}
+}
+
+// Builds the JSON schemas of Go types. The named struct types are added to
+// the components of the document and referenced from the other schemas.
+type openAPISchemas struct {
+	types      []reflect.Type
+	components map[reflect.Type]*openAPIComponent
+}
+
+// The schema of a named struct type, and the references to it. The
+// references are completed once all the types are known, since the key of
+// the component depends on the other types that have the same name.
+type openAPIComponent struct {
+	schema map[string]interface{}
+	refs   []map[string]interface{}
+}
+
+func newOpenAPISchemas() *openAPISchemas {
+	output := new(openAPISchemas)
+	output.components = make(map[reflect.Type]*openAPIComponent)
+	return output
+}
+
+// Returns the component schemas, and completes the references to them. The
+// components are keyed by type name, or by package path and type name if
+// several types have the same name.
+func (this *openAPISchemas) schemas() map[string]interface{} {
+	names := make(map[string]int)
+	for _, t := range this.types {
+		names[t.Name()]++
+	}
+	output := make(map[string]interface{})
+	for _, t := range this.types {
+		key := t.Name()
+		if names[key] > 1 {
+			key = openAPIQualifiedName(t)
+		}
+		// Types declared in functions have the same package path.
+		for i := 2; output[key] != nil; i++ {
+			key = openAPIQualifiedName(t) + "_" + strconv.Itoa(i)
+		}
+		component := this.components[t]
+		output[key] = component.schema
+		for _, ref := range component.refs {
+			ref["$ref"] = "#/components/schemas/" + key
+		}
+	}
+	return output
+}
+
+// Returns the package path and name of the type, with only the characters
+// allowed in component keys, such as "github.com.user.models.User".
+func openAPIQualifiedName(t reflect.Type) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' {
+			return '.'
+		}
+		if r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, t.PkgPath()+"."+t.Name())
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+func (this *openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": this.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": this.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return this.structSchema(t)
+		}
+		component, ok := this.components[t]
+		if !ok {
+			// Registered before being built, in case the type is recursive.
+			component = new(openAPIComponent)
+			this.components[t] = component
+			this.types = append(this.types, t)
+			component.schema = this.structSchema(t)
+		}
+		ref := make(map[string]interface{})
+		component.refs = append(component.refs, ref)
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+func (this *openAPISchemas) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	this.addStructFields(t, properties, &required)
+	output := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		output["required"] = required
+	}
+	return output
+}
+
+// Adds the properties of the struct fields, following the rules of
+// encoding/json for the field names and embedded structs.
+func (this *openAPISchemas) addStructFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		tagParts := strings.Split(tag, ",")
+		name := tagParts[0]
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			this.addStructFields(fieldType, properties, required)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = this.schema(field.Type)
+		if !containsString(tagParts[1:], "omitempty") && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+var yamlPlainRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// Writes a value decoded by decodeJson() as YAML.
+func writeYaml(output *strings.Builder, value interface{}, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var keys []string
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			output.WriteString(prefix + yamlScalar(key) + ":")
+			writeYamlChild(output, v[key], indent+2)
+		}
+	case []interface{}:
+		for _, item := range v {
+			output.WriteString(prefix + "-")
+			if object, ok := item.(map[string]interface{}); ok && len(object) > 0 {
+				// The first key goes on the same line as the dash.
+				var child strings.Builder
+				writeYaml(&child, object, indent+2)
+				output.WriteString(" " + strings.TrimPrefix(child.String(), prefix+"  "))
+			} else {
+				writeYamlChild(output, item, indent+2)
+			}
+		}
+	}
+}
+
+func writeYamlChild(output *strings.Builder, value interface{}, indent int) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			output.WriteString(" {}\n")
+			return
+		}
+		output.WriteString("\n")
+		writeYaml(output, v, indent)
+	case []interface{}:
+		if len(v) == 0 {
+			output.WriteString(" []\n")
+			return
+		}
+		output.WriteString("\n")
+		writeYaml(output, v, indent)
+	default:
+		output.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if yamlPlainRegexp.MatchString(v) && !isYamlKeyword(v) {
+			return v
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return ""
+}
+
+// Tells whether a plain string would be read as another type by YAML parsers.
+func isYamlKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "y", "n":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+package ripple
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type openAPITestUser struct {
+	Id       int
+	Name     string `json:"name"`
+	Email    string `json:"email,omitempty"`
+	Friends  []openAPITestUser
+	Created  time.Time
+	Secret   string `json:"-"`
+	internal int
+}
+
+type openAPITestUserWrapper struct {
+	User openAPITestUser
+}
+
+type ControllerOpenAPITester struct{}
+
+func (this *ControllerOpenAPITester) Get(ctx *Context)        {}
+func (this *ControllerOpenAPITester) Post(ctx *Context)       {}
+func (this *ControllerOpenAPITester) GetFriends(ctx *Context) {}
+func (this *ControllerOpenAPITester) Helper()                 {}
+
+func (this *ControllerOpenAPITester) OpenAPIOperations() map[string]OpenAPIOperation {
+	return map[string]OpenAPIOperation{
+		"Get":  {Summary: "Get a user", Response: openAPITestUser{}},
+		"Post": {Summary: "Create a user", Request: &openAPITestUser{}, Response: openAPITestUser{}, Deprecated: true},
+	}
+}
+
+func newOpenAPITestApplication() *Application {
+	app := NewApplication()
+	app.SetBaseUrl("/api/")
+	app.RegisterController("users", &ControllerOpenAPITester{})
+	app.RegisterController("tasks", &ControllerTesters4{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+	return app
+}
+
+func TestOpenAPI(t *testing.T) {
+	app := newOpenAPITestApplication()
+	data, err := app.OpenAPI().JSON()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	var doc map[string]interface{}
+	json.Unmarshal(data, &doc)
+
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("Expected %s, got %v", "3.1.0", doc["openapi"])
+	}
+	servers := doc["servers"].([]interface{})
+	if servers[0].(map[string]interface{})["url"] != "/api" {
+		t.Errorf("Expected %s, got %v", "/api", servers[0])
+	}
+
+	var paths []string
+	for path, item := range doc["paths"].(map[string]interface{}) {
+		var methods []string
+		for method := range item.(map[string]interface{}) {
+			methods = append(methods, method)
+		}
+		paths = append(paths, path+" "+strings.Join(sortedStrings(methods), ","))
+	}
+	expectedPaths := []string{
+		"/tasks get",
+		"/tasks/{id} get",
+		"/tasks/{id}/other get",
+		"/users get,post",
+		"/users/{id} get,post",
+		"/users/{id}/friends get",
+	}
+	if !reflect.DeepEqual(sortedStrings(paths), expectedPaths) {
+		t.Errorf("Expected %v, got %v", expectedPaths, sortedStrings(paths))
+	}
+
+	post := doc["paths"].(map[string]interface{})["/users/{id}"].(map[string]interface{})["post"].(map[string]interface{})
+	type testCase struct {
+		path     string
+		expected interface{}
+	}
+	testCases := []testCase{
+		{"operationId", "usersPost"},
+		{"summary", "Create a user"},
+		{"deprecated", true},
+		{"parameters.0.name", "id"},
+		{"parameters.0.in", "path"},
+		{"requestBody.content.application/json.schema.$ref", "#/components/schemas/openAPITestUser"},
+		{"responses.201.description", "Created"},
+		{"responses.default.content.application/json.schema.$ref", "#/components/schemas/ErrorBody"},
+	}
+	for i, d := range testCases {
+		v := jsonPath(post, d.path)
+		if v != d.expected {
+			t.Errorf("Test %d: Expected %v, got %v", i, d.expected, v)
+		}
+	}
+
+	schema := jsonPath(doc, "components.schemas.openAPITestUser").(map[string]interface{})
+	var properties []string
+	for name := range schema["properties"].(map[string]interface{}) {
+		properties = append(properties, name)
+	}
+	expectedProperties := []string{"Created", "Friends", "Id", "email", "name"}
+	if !reflect.DeepEqual(sortedStrings(properties), expectedProperties) {
+		t.Errorf("Expected %v, got %v", expectedProperties, sortedStrings(properties))
+	}
+	if jsonPath(schema, "properties.Friends.items.$ref") != "#/components/schemas/openAPITestUser" {
+		t.Errorf("Expected recursive reference, got %v", jsonPath(schema, "properties.Friends"))
+	}
+	if jsonPath(schema, "properties.Created.format") != "date-time" {
+		t.Errorf("Expected %s, got %v", "date-time", jsonPath(schema, "properties.Created.format"))
+	}
+	required, _ := json.Marshal(schema["required"])
+	if string(required) != "[\"Created\",\"Friends\",\"Id\",\"name\"]" {
+		t.Errorf("Expected %s, got %s", "[\"Created\",\"Friends\",\"Id\",\"name\"]", required)
+	}
+}
+
+func TestOpenAPISchemaNames(t *testing.T) {
+	type Cookie struct {
+		Value string
+	}
+	type openAPITestUser struct {
+		Cookie Cookie
+	}
+	pkg := strings.Replace(reflect.TypeOf(Cookie{}).PkgPath(), "/", ".", -1)
+
+	type testCase struct {
+		value    interface{}
+		expected string
+	}
+
+	testCases := []testCase{
+		{http.Cookie{}, "net.http.Cookie"},
+		{Cookie{}, pkg + ".Cookie"},
+		{ErrorBody{}, "ErrorBody"},
+		{[]ErrorBody{}, "ErrorBody"},
+		{openAPITestUserWrapper{}, "openAPITestUserWrapper"},
+		{openAPITestUser{}, pkg + ".openAPITestUser_2"},
+	}
+
+	schemas := newOpenAPISchemas()
+	var refs []map[string]interface{}
+	for _, d := range testCases {
+		refs = append(refs, schemas.schema(reflect.TypeOf(d.value)))
+	}
+	components := schemas.schemas()
+	for i, d := range testCases {
+		ref := refs[i]["$ref"]
+		if ref == nil {
+			ref = jsonPath(refs[i], "items.$ref")
+		}
+		if ref != "#/components/schemas/"+d.expected {
+			t.Errorf("Test %d: Expected %s, got %v", i, "#/components/schemas/"+d.expected, ref)
+		}
+		if components[d.expected] == nil {
+			t.Errorf("Test %d: Expected component %s, got %v", i, d.expected, components)
+		}
+	}
+	if len(components) != 6 {
+		t.Errorf("Expected %d components, got %d", 6, len(components))
+	}
+	if jsonPath(components[pkg+".openAPITestUser"], "properties.Friends.items.$ref") != "#/components/schemas/"+pkg+".openAPITestUser" {
+		t.Errorf("Expected the reference to be qualified, got %v", components[pkg+".openAPITestUser"])
+	}
+}
+
+func TestOpenAPIYaml(t *testing.T) {
+	doc := OpenAPIDocument{
+		"openapi": "3.1.0",
+		"paths": map[string]interface{}{
+			"/users/{id}": map[string]interface{}{
+				"parameters": []interface{}{
+					map[string]interface{}{"name": "id", "required": true},
+				},
+				"tags": []string{"users", "yes"},
+			},
+		},
+		"empty": map[string]interface{}{},
+	}
+	data, err := doc.YAML()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	expected := "empty: {}\n" +
+		"openapi: \"3.1.0\"\n" +
+		"paths:\n" +
+		"  \"/users/{id}\":\n" +
+		"    parameters:\n" +
+		"      - name: id\n" +
+		"        required: true\n" +
+		"    tags:\n" +
+		"      - users\n" +
+		"      - \"yes\"\n"
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
+
+func TestOpenAPIEndpoint(t *testing.T) {
+	app := newOpenAPITestApplication()
+	app.Use(app.OpenAPI().Endpoint("/openapi.json", "/openapi.yaml"))
+
+	type testCase struct {
+		url                 string
+		expectedStatus      int
+		expectedContentType string
+	}
+
+	testCases := []testCase{
+		{"/api/openapi.json", http.StatusOK, "application/json"},
+		{"/api/openapi.yaml", http.StatusOK, "application/yaml"},
+		{"/api/users", http.StatusOK, ""},
+		{"/api/nothere/1/2/3", http.StatusNotFound, ""},
+	}
+
+	for i, d := range testCases {
+		request, _ := http.NewRequest("GET", d.url, nil)
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != d.expectedStatus {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.expectedStatus, ctx.Response.Status)
+		}
+		if ctx.Response.Header.Get("Content-Type") != d.expectedContentType {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.expectedContentType, ctx.Response.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func sortedStrings(list []string) []string {
+	output := append([]string(nil), list...)
+	sort.Strings(output)
+	return output
+}
+
+// Returns the value at the given dot-separated path of a decoded JSON value.
+func jsonPath(value interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil
+			}
+			value = v[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
@@ -0,0 +1,275 @@
+package ripple
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Returned by Context.Pagination() when the pagination parameters of the
+// request are invalid.
+var ErrInvalidPagination = errors.New("invalid pagination parameters")
+
+// The pagination parameters of a request, as parsed by Context.Pagination().
+type Pagination struct {
+	// The requested page, starting at 1. Zero when a cursor is used.
+	Page int
+	// The maximum number of items per page.
+	Limit int
+	// The decoded cursor, or an empty string if the request has no cursor.
+	Cursor string
+}
+
+// Returns the index of the first item of the page. The offset is capped at
+// math.MaxInt if the page is too large for it to be represented.
+func (this *Pagination) Offset() int {
+	if this.Page <= 0 || this.Limit <= 0 {
+		return 0
+	}
+	if this.Page-1 > math.MaxInt/this.Limit {
+		return math.MaxInt
+	}
+	return (this.Page - 1) * this.Limit
+}
+
+// Parses the "page", "limit" and "cursor" query parameters of the request. The
+// limit defaults to defaultLimit and is capped at maxLimit. Returns
+// ErrInvalidPagination if a parameter is not valid, in which case the action
+// would usually respond with a 400 Bad Request.
+//
+//	func (this *UserController) Get(ctx *ripple.Context) {
+//		pagination, err := ctx.Pagination(20, 100)
+//		if err != nil {
+//			ctx.Error(http.StatusBadRequest, err.Error())
+//			return
+//		}
+//		users, total := this.userCollection.Range(pagination.Offset(), pagination.Limit)
+//		ctx.SetPage(ripple.NewPage(users, pagination, total))
+//	}
+func (this *Context) Pagination(defaultLimit int, maxLimit int) (*Pagination, error) {
+	query := this.Request.URL.Query()
+	output := new(Pagination)
+	output.Limit = defaultLimit
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, ErrInvalidPagination
+		}
+		output.Limit = limit
+	}
+	if maxLimit > 0 && output.Limit > maxLimit {
+		output.Limit = maxLimit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := DecodeCursor(value)
+		if err != nil {
+			return nil, ErrInvalidPagination
+		}
+		output.Cursor = cursor
+		return output, nil
+	}
+
+	output.Page = 1
+	if value := query.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		// The offset of the page must not overflow.
+		if err != nil || page < 1 || (output.Limit > 0 && page-1 > math.MaxInt/output.Limit) {
+			return nil, ErrInvalidPagination
+		}
+		output.Page = page
+	}
+	return output, nil
+}
+
+// Encodes a cursor value, such as the ID of the last item of a page, so that
+// it can be sent to the client as an opaque string.
+func EncodeCursor(value string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// Decodes a cursor built by EncodeCursor().
+func DecodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// A page of items. Use NewPage() or NewCursorPage() to build it, then
+// Context.SetPage() to send it to the client, along with the Link headers
+// that point to the other pages.
+type Page struct {
+	Items interface{}
+	// The page number, starting at 1. Zero for a cursor-based page.
+	Page  int
+	Limit int
+	// The total number of items, or -1 if it is unknown.
+	Total int
+	// The encoded cursors of the next and previous pages, if any.
+	NextCursor string
+	PrevCursor string
+}
+
+// Build a new page from the page number of the request. total is the total
+// number of items, or -1 if it is unknown, in which case the client can still
+// move to the next page as long as the current page is full.
+func NewPage(items interface{}, pagination *Pagination, total int) *Page {
+	output := new(Page)
+	output.Items = items
+	output.Page = pagination.Page
+	output.Limit = pagination.Limit
+	output.Total = total
+	return output
+}
+
+// Build a new cursor-based page. nextCursor and prevCursor are the values to
+// resume from, such as the IDs of the last and first items, and can be empty
+// if there is no next or previous page. They are encoded with EncodeCursor().
+func NewCursorPage(items interface{}, pagination *Pagination, nextCursor string, prevCursor string) *Page {
+	output := new(Page)
+	output.Items = items
+	output.Limit = pagination.Limit
+	output.Total = -1
+	if nextCursor != "" {
+		output.NextCursor = EncodeCursor(nextCursor)
+	}
+	if prevCursor != "" {
+		output.PrevCursor = EncodeCursor(prevCursor)
+	}
+	return output
+}
+
+// Returns the number of pages, or -1 if it is unknown.
+func (this *Page) PageCount() int {
+	if this.Total < 0 || this.Limit <= 0 {
+		return -1
+	}
+	if this.Total == 0 {
+		return 1
+	}
+	return (this.Total-1)/this.Limit + 1
+}
+
+func (this *Page) itemCount() int {
+	v := reflect.ValueOf(this.Items)
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		return v.Len()
+	}
+	return 0
+}
+
+func (this *Page) hasNext() bool {
+	if this.Page <= 0 {
+		return this.NextCursor != ""
+	}
+	if this.Total >= 0 {
+		return this.Page < this.PageCount()
+	}
+	return this.itemCount() >= this.Limit
+}
+
+type pageJson struct {
+	Items      interface{}
+	Page       int `json:",omitempty"`
+	Limit      int
+	Total      *int   `json:",omitempty"`
+	PageCount  *int   `json:",omitempty"`
+	NextCursor string `json:",omitempty"`
+	PrevCursor string `json:",omitempty"`
+}
+
+// Serializes the page along with its metadata. The unknown values are
+// omitted.
+func (this *Page) MarshalJSON() ([]byte, error) {
+	var output pageJson
+	output.Items = this.Items
+	v := reflect.ValueOf(this.Items)
+	if !v.IsValid() || (v.Kind() == reflect.Slice && v.IsNil()) {
+		output.Items = []interface{}{}
+	}
+	output.Page = this.Page
+	output.Limit = this.Limit
+	if this.Total >= 0 {
+		total := this.Total
+		pageCount := this.PageCount()
+		output.Total = &total
+		output.PageCount = &pageCount
+	}
+	output.NextCursor = this.NextCursor
+	output.PrevCursor = this.PrevCursor
+	return json.Marshal(output)
+}
+
+// Sets the page as the response body and adds the Link headers (RFC 8288)
+// that point to the first, previous, next and last pages. The links are built
+// from the current route and query string.
+func (this *Context) SetPage(page *Page) {
+	this.Response.Body = page
+	links := this.pageLinks(page)
+	if len(links) > 0 {
+		this.Response.Header.Set("Link", strings.Join(links, ", "))
+	}
+}
+
+func (this *Context) pageLinks(page *Page) []string {
+	path := this.Request.URL.EscapedPath()
+	query := this.Request.URL.Query()
+	if this.app != nil && this.match.Success {
+		u, err := this.app.URLFor(this.match.ControllerName, this.match.ActionName, this.Params)
+		if err == nil {
+			parsed, err := url.Parse(u)
+			if err == nil {
+				path = parsed.EscapedPath()
+				for name, values := range parsed.Query() {
+					query[name] = values
+				}
+			}
+		}
+	}
+	query.Del("page")
+	query.Del("cursor")
+	query.Set("limit", strconv.Itoa(page.Limit))
+
+	link := func(name string, value string, rel string) string {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if name != "" {
+			q.Set(name, value)
+		}
+		return "<" + path + "?" + q.Encode() + ">; rel=\"" + rel + "\""
+	}
+
+	var output []string
+	if page.Page <= 0 {
+		output = append(output, link("", "", "first"))
+		if page.PrevCursor != "" {
+			output = append(output, link("cursor", page.PrevCursor, "prev"))
+		}
+		if page.NextCursor != "" {
+			output = append(output, link("cursor", page.NextCursor, "next"))
+		}
+		return output
+	}
+
+	output = append(output, link("page", "1", "first"))
+	if page.Page > 1 {
+		output = append(output, link("page", strconv.Itoa(page.Page-1), "prev"))
+	}
+	if page.hasNext() {
+		output = append(output, link("page", strconv.Itoa(page.Page+1), "next"))
+	}
+	if page.Total >= 0 {
+		output = append(output, link("page", strconv.Itoa(page.PageCount()), "last"))
+	}
+	return output
+}
@@ -0,0 +1,154 @@
+package ripple
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+type ControllerPaginationTester struct {
+	total int
+}
+
+func (this *ControllerPaginationTester) Get(ctx *Context) {
+	pagination, err := ctx.Pagination(10, 50)
+	if err != nil {
+		ctx.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	var items []int
+	for i := pagination.Offset(); i < this.total && len(items) < pagination.Limit; i++ {
+		items = append(items, i)
+	}
+	total := this.total
+	if ctx.Request.URL.Query().Get("total") == "unknown" {
+		total = -1
+	}
+	ctx.SetPage(NewPage(items, pagination, total))
+}
+
+func (this *ControllerPaginationTester) GetFeed(ctx *Context) {
+	pagination, err := ctx.Pagination(2, 0)
+	if err != nil {
+		ctx.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	if pagination.Cursor == "" {
+		ctx.SetPage(NewCursorPage([]string{"a", "b"}, pagination, "b", ""))
+	} else {
+		ctx.SetPage(NewCursorPage([]string{"c"}, pagination, "", "c"))
+	}
+}
+
+func TestPagination(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("users", &ControllerPaginationTester{total: 25})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+
+	type testCase struct {
+		url            string
+		expectedStatus int
+		expectedBody   string
+		expectedLink   string
+	}
+
+	testCases := []testCase{
+		{
+			"/users?page=2&limit=10&sort=name",
+			http.StatusOK,
+			"{\"Items\":[10,11,12,13,14,15,16,17,18,19],\"Page\":2,\"Limit\":10,\"Total\":25,\"PageCount\":3}",
+			"</users?limit=10&page=1&sort=name>; rel=\"first\", </users?limit=10&page=1&sort=name>; rel=\"prev\", </users?limit=10&page=3&sort=name>; rel=\"next\", </users?limit=10&page=3&sort=name>; rel=\"last\"",
+		},
+		{
+			"/users?page=3",
+			http.StatusOK,
+			"{\"Items\":[20,21,22,23,24],\"Page\":3,\"Limit\":10,\"Total\":25,\"PageCount\":3}",
+			"</users?limit=10&page=1>; rel=\"first\", </users?limit=10&page=2>; rel=\"prev\", </users?limit=10&page=3>; rel=\"last\"",
+		},
+		{
+			"/users?limit=1000&total=unknown",
+			http.StatusOK,
+			"{\"Items\":[0,1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23,24],\"Page\":1,\"Limit\":50}",
+			"</users?limit=50&page=1&total=unknown>; rel=\"first\"",
+		},
+		{
+			"/users?page=9",
+			http.StatusOK,
+			"{\"Items\":[],\"Page\":9,\"Limit\":10,\"Total\":25,\"PageCount\":3}",
+			"</users?limit=10&page=1>; rel=\"first\", </users?limit=10&page=8>; rel=\"prev\", </users?limit=10&page=3>; rel=\"last\"",
+		},
+		{
+			"/users?page=" + strconv.Itoa(math.MaxInt/10+1),
+			http.StatusOK,
+			"{\"Items\":[],\"Page\":" + strconv.Itoa(math.MaxInt/10+1) + ",\"Limit\":10,\"Total\":25,\"PageCount\":3}",
+			"</users?limit=10&page=1>; rel=\"first\", </users?limit=10&page=" + strconv.Itoa(math.MaxInt/10) + ">; rel=\"prev\", </users?limit=10&page=3>; rel=\"last\"",
+		},
+		{"/users?page=" + strconv.Itoa(math.MaxInt/10+2), http.StatusBadRequest, "", ""},
+		{"/users?page=0", http.StatusBadRequest, "", ""},
+		{"/users?limit=abc", http.StatusBadRequest, "", ""},
+		{"/users?cursor=!!!", http.StatusBadRequest, "", ""},
+		{
+			"/users/1/feed",
+			http.StatusOK,
+			"{\"Items\":[\"a\",\"b\"],\"Limit\":2,\"NextCursor\":\"Yg\"}",
+			"</users/1/feed?limit=2>; rel=\"first\", </users/1/feed?cursor=Yg&limit=2>; rel=\"next\"",
+		},
+		{
+			"/users/1/feed?cursor=Yg",
+			http.StatusOK,
+			"{\"Items\":[\"c\"],\"Limit\":2,\"PrevCursor\":\"Yw\"}",
+			"</users/1/feed?limit=2>; rel=\"first\", </users/1/feed?cursor=Yw&limit=2>; rel=\"prev\"",
+		},
+	}
+
+	for i, d := range testCases {
+		request, _ := http.NewRequest("GET", d.url, nil)
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != d.expectedStatus {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.expectedStatus, ctx.Response.Status)
+			continue
+		}
+		if d.expectedStatus != http.StatusOK {
+			continue
+		}
+		body, _ := app.serializeResponseBody(ctx.Response.Body)
+		if body != d.expectedBody {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.expectedBody, body)
+		}
+		if ctx.Response.Header.Get("Link") != d.expectedLink {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.expectedLink, ctx.Response.Header.Get("Link"))
+		}
+	}
+}
+
+func TestPaginationOffset(t *testing.T) {
+	type testCase struct {
+		page     int
+		limit    int
+		expected int
+	}
+
+	testCases := []testCase{
+		{1, 10, 0},
+		{3, 10, 20},
+		{0, 10, 0},
+		{3, 0, 0},
+		{math.MaxInt/10 + 1, 10, math.MaxInt / 10 * 10},
+		{math.MaxInt/10 + 2, 10, math.MaxInt},
+		{math.MaxInt, math.MaxInt, math.MaxInt},
+	}
+
+	for i, d := range testCases {
+		pagination := &Pagination{Page: d.page, Limit: d.limit}
+		if offset := pagination.Offset(); offset != d.expected {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.expected, offset)
+		}
+	}
+
+	page := &Page{Limit: math.MaxInt, Total: math.MaxInt}
+	if page.PageCount() != 1 {
+		t.Errorf("Expected %d, got %d", 1, page.PageCount())
+	}
+}
@@ -0,0 +1,550 @@
+package ripple
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Returned by Context.ApplyPatch() when the request Content-Type is neither
+// "application/merge-patch+json" nor "application/json-patch+json".
+var ErrUnsupportedPatchType = errors.New("unsupported patch content type")
+
+// An error that occurred while applying a patch.
+type PatchError struct {
+	// The index of the failed operation for JSON Patch, or -1.
+	Index int
+	// The failed operation ("add", "test", etc.), if any.
+	Op string
+	// The JSON pointer to the location where the error occurred, if any.
+	Path    string
+	Message string
+	// The suggested HTTP status: 400 Bad Request for an invalid patch, 409
+	// Conflict when a test operation fails, and 422 Unprocessable Entity when
+	// the patch cannot be applied to the document.
+	Status int
+}
+
+func (this *PatchError) Error() string {
+	output := ""
+	if this.Index >= 0 {
+		output = fmt.Sprintf("operation %d", this.Index)
+		if this.Op != "" {
+			output += " (" + this.Op + ")"
+		}
+		output += ": "
+	}
+	if this.Path != "" {
+		output += this.Path + ": "
+	}
+	return output + this.Message
+}
+
+func newPatchError(status int, path string, message string) *PatchError {
+	output := new(PatchError)
+	output.Index = -1
+	output.Path = path
+	output.Message = message
+	output.Status = status
+	return output
+}
+
+// Applies the patch contained in the request body to target. The patch format
+// is selected by the Content-Type of the request: "application/merge-patch+json"
+// for a JSON Merge Patch (RFC 7396) or "application/json-patch+json" for a JSON
+// Patch (RFC 6902). target can be a pointer to any value that can be converted
+// to and from JSON, or a pointer to a []byte or json.RawMessage holding raw
+// JSON. For example:
+//
+//	func (this *UserController) Patch(ctx *ripple.Context) {
+//		user := this.userCollection.Get(userId)
+//		err := ctx.ApplyPatch(&user)
+//		if patchErr, ok := err.(*ripple.PatchError); ok {
+//			ctx.Error(patchErr.Status, patchErr.Error())
+//			return
+//		} else if err != nil {
+//			ctx.Error(http.StatusUnsupportedMediaType, "")
+//			return
+//		}
+//		ctx.Response.Body = this.userCollection.Set(userId, user)
+//	}
+func (this *Context) ApplyPatch(target interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(this.Request.Header.Get("Content-Type"))
+	var apply func(doc []byte, patch []byte) ([]byte, error)
+	switch mediaType {
+	case "application/merge-patch+json":
+		apply = MergePatch
+	case "application/json-patch+json":
+		apply = JsonPatch
+	default:
+		return ErrUnsupportedPatchType
+	}
+
+	patch, err := io.ReadAll(this.Request.Body)
+	if err != nil {
+		return err
+	}
+
+	switch target.(type) {
+
+	case *[]byte:
+
+		raw := target.(*[]byte)
+		output, err := apply(*raw, patch)
+		if err != nil {
+			return err
+		}
+		*raw = output
+		return nil
+
+	case *json.RawMessage:
+
+		raw := target.(*json.RawMessage)
+		output, err := apply(*raw, patch)
+		if err != nil {
+			return err
+		}
+		*raw = output
+		return nil
+
+	}
+
+	targetVal := reflect.ValueOf(target)
+	if targetVal.Kind() != reflect.Ptr || targetVal.IsNil() {
+		return errors.New("patch target must be a non-nil pointer")
+	}
+	doc, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	output, err := apply(doc, patch)
+	if err != nil {
+		return err
+	}
+	// The result is decoded into a new value, so that the fields removed
+	// by the patch are reset rather than left untouched.
+	newVal := reflect.New(targetVal.Elem().Type())
+	err = json.Unmarshal(output, newVal.Interface())
+	if err != nil {
+		return newPatchError(http.StatusUnprocessableEntity, "", "patched document is not valid: "+err.Error())
+	}
+	targetVal.Elem().Set(newVal.Elem())
+	return nil
+}
+
+func decodeJson(data []byte) (interface{}, error) {
+	var output interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&output)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return output, nil
+}
+
+// Applies a JSON Merge Patch (RFC 7396) to a JSON document.
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	patchVal, err := decodeJson(patch)
+	if err != nil {
+		return nil, newPatchError(http.StatusBadRequest, "", "invalid patch: "+err.Error())
+	}
+	var docVal interface{}
+	if len(bytes.TrimSpace(doc)) > 0 {
+		docVal, err = decodeJson(doc)
+		if err != nil {
+			return nil, newPatchError(http.StatusUnprocessableEntity, "", "invalid document: "+err.Error())
+		}
+	}
+	return json.Marshal(mergePatch(docVal, patchVal))
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+type jsonPatchOperation struct {
+	Op    string
+	Path  *string
+	From  *string
+	Value *json.RawMessage
+}
+
+// The operation members are decoded individually, since a "value" member
+// set to null must be distinguished from a missing one.
+func (this *jsonPatchOperation) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	err := json.Unmarshal(data, &members)
+	if err != nil {
+		return err
+	}
+	if op, ok := members["op"]; ok {
+		err = json.Unmarshal(op, &this.Op)
+		if err != nil {
+			return err
+		}
+	}
+	for name, target := range map[string]**string{"path": &this.Path, "from": &this.From} {
+		member, ok := members[name]
+		if !ok {
+			continue
+		}
+		*target = new(string)
+		err = json.Unmarshal(member, *target)
+		if err != nil {
+			return err
+		}
+	}
+	if value, ok := members["value"]; ok {
+		this.Value = &value
+	}
+	return nil
+}
+
+// Applies a JSON Patch (RFC 6902) to a JSON document. The operations are
+// applied in order, and if one of them fails, the whole patch fails.
+func JsonPatch(doc []byte, patch []byte) ([]byte, error) {
+	var operations []jsonPatchOperation
+	err := json.Unmarshal(patch, &operations)
+	if err != nil {
+		return nil, newPatchError(http.StatusBadRequest, "", "invalid patch: "+err.Error())
+	}
+	docVal, err := decodeJson(doc)
+	if err != nil {
+		return nil, newPatchError(http.StatusUnprocessableEntity, "", "invalid document: "+err.Error())
+	}
+
+	for i, operation := range operations {
+		docVal, err = applyJsonPatchOperation(docVal, operation)
+		if err != nil {
+			patchErr := err.(*PatchError)
+			patchErr.Index = i
+			patchErr.Op = operation.Op
+			return nil, patchErr
+		}
+	}
+	return json.Marshal(docVal)
+}
+
+func applyJsonPatchOperation(doc interface{}, operation jsonPatchOperation) (interface{}, error) {
+	if operation.Path == nil {
+		return nil, newPatchError(http.StatusBadRequest, "", "missing \"path\"")
+	}
+	path := *operation.Path
+	tokens, err := parseJsonPointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if operation.Op == "add" || operation.Op == "replace" || operation.Op == "test" {
+		if operation.Value == nil {
+			return nil, newPatchError(http.StatusBadRequest, path, "missing \"value\"")
+		}
+		value, err = decodeJson(*operation.Value)
+		if err != nil {
+			return nil, newPatchError(http.StatusBadRequest, path, "invalid value: "+err.Error())
+		}
+	}
+
+	var from string
+	var fromTokens []string
+	if operation.Op == "move" || operation.Op == "copy" {
+		if operation.From == nil {
+			return nil, newPatchError(http.StatusBadRequest, path, "missing \"from\"")
+		}
+		from = *operation.From
+		fromTokens, err = parseJsonPointer(from)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch operation.Op {
+
+	case "add":
+
+		return jsonPatchAdd(doc, tokens, path, value)
+
+	case "remove":
+
+		return jsonPatchRemove(doc, tokens, path)
+
+	case "replace":
+
+		_, err = jsonPointerGet(doc, tokens, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(tokens) == 0 {
+			return value, nil
+		}
+		doc, err = jsonPatchRemove(doc, tokens, path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPatchAdd(doc, tokens, path, value)
+
+	case "move":
+
+		if from == path {
+			return doc, nil
+		}
+		if strings.HasPrefix(path, from+"/") {
+			return nil, newPatchError(http.StatusUnprocessableEntity, path, "cannot move a value into one of its children")
+		}
+		value, err = jsonPointerGet(doc, fromTokens, from)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = jsonPatchRemove(doc, fromTokens, from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPatchAdd(doc, tokens, path, value)
+
+	case "copy":
+
+		value, err = jsonPointerGet(doc, fromTokens, from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPatchAdd(doc, tokens, path, copyJsonValue(value))
+
+	case "test":
+
+		current, err := jsonPointerGet(doc, tokens, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonValuesEqual(current, value) {
+			return nil, newPatchError(http.StatusConflict, path, "test failed")
+		}
+		return doc, nil
+
+	}
+
+	return nil, newPatchError(http.StatusBadRequest, path, "unknown operation \""+operation.Op+"\"")
+}
+
+// Parses a JSON pointer (RFC 6901) into its reference tokens.
+func parseJsonPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if pointer[0] != '/' {
+		return nil, newPatchError(http.StatusBadRequest, pointer, "invalid JSON pointer")
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// Parses an array index. "-" refers to the position after the last element,
+// which is only valid when adding a value.
+func jsonArrayIndex(token string, length int, allowEnd bool, path string) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || strings.TrimLeft(token, "0123456789") != "" || (len(token) > 1 && token[0] == '0') {
+		return 0, newPatchError(http.StatusUnprocessableEntity, path, "invalid array index \""+token+"\"")
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if index > max {
+		return 0, newPatchError(http.StatusUnprocessableEntity, path, "array index out of bounds")
+	}
+	return index, nil
+}
+
+func jsonPointerGet(doc interface{}, tokens []string, path string) (interface{}, error) {
+	for _, token := range tokens {
+		switch doc.(type) {
+		case map[string]interface{}:
+			value, ok := doc.(map[string]interface{})[token]
+			if !ok {
+				return nil, newPatchError(http.StatusUnprocessableEntity, path, "path not found")
+			}
+			doc = value
+		case []interface{}:
+			array := doc.([]interface{})
+			index, err := jsonArrayIndex(token, len(array), false, path)
+			if err != nil {
+				return nil, err
+			}
+			doc = array[index]
+		default:
+			return nil, newPatchError(http.StatusUnprocessableEntity, path, "path not found")
+		}
+	}
+	return doc, nil
+}
+
+// Applies fn to the parent of the location referenced by tokens, and returns
+// the updated document. fn returns the updated parent, since arrays may need
+// to be reallocated.
+func jsonPatchUpdateParent(doc interface{}, tokens []string, path string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	child, err := jsonPointerGet(doc, tokens[0:1], path)
+	if err != nil {
+		return nil, err
+	}
+	child, err = jsonPatchUpdateParent(child, tokens[1:], path, fn)
+	if err != nil {
+		return nil, err
+	}
+	switch doc.(type) {
+	case map[string]interface{}:
+		doc.(map[string]interface{})[tokens[0]] = child
+	case []interface{}:
+		index, _ := strconv.Atoi(tokens[0])
+		doc.([]interface{})[index] = child
+	}
+	return doc, nil
+}
+
+func jsonPatchAdd(doc interface{}, tokens []string, path string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonPatchUpdateParent(doc, tokens, path, func(parent interface{}, key string) (interface{}, error) {
+		switch parent.(type) {
+		case map[string]interface{}:
+			parent.(map[string]interface{})[key] = value
+			return parent, nil
+		case []interface{}:
+			array := parent.([]interface{})
+			index, err := jsonArrayIndex(key, len(array), true, path)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, nil)
+			copy(array[index+1:], array[index:])
+			array[index] = value
+			return array, nil
+		}
+		return nil, newPatchError(http.StatusUnprocessableEntity, path, "parent is not an object or array")
+	})
+}
+
+func jsonPatchRemove(doc interface{}, tokens []string, path string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, newPatchError(http.StatusUnprocessableEntity, path, "cannot remove the whole document")
+	}
+	return jsonPatchUpdateParent(doc, tokens, path, func(parent interface{}, key string) (interface{}, error) {
+		switch parent.(type) {
+		case map[string]interface{}:
+			object := parent.(map[string]interface{})
+			if _, ok := object[key]; !ok {
+				return nil, newPatchError(http.StatusUnprocessableEntity, path, "path not found")
+			}
+			delete(object, key)
+			return object, nil
+		case []interface{}:
+			array := parent.([]interface{})
+			index, err := jsonArrayIndex(key, len(array), false, path)
+			if err != nil {
+				return nil, err
+			}
+			return append(array[0:index], array[index+1:]...), nil
+		}
+		return nil, newPatchError(http.StatusUnprocessableEntity, path, "path not found")
+	})
+}
+
+func copyJsonValue(value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}:
+		output := make(map[string]interface{})
+		for k, v := range value.(map[string]interface{}) {
+			output[k] = copyJsonValue(v)
+		}
+		return output
+	case []interface{}:
+		output := make([]interface{}, len(value.([]interface{})))
+		for i, v := range value.([]interface{}) {
+			output[i] = copyJsonValue(v)
+		}
+		return output
+	}
+	return value
+}
+
+// Compares two JSON values. Numbers are compared by value, so 1 and 1.0
+// are equal.
+func jsonValuesEqual(a interface{}, b interface{}) bool {
+	if na, ok := a.(json.Number); ok {
+		nb, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, errA := na.Float64()
+		fb, errB := nb.Float64()
+		if errA != nil || errB != nil {
+			return na == nb
+		}
+		return fa == fb
+	}
+
+	switch a.(type) {
+	case map[string]interface{}:
+		ma := a.(map[string]interface{})
+		mb, ok := b.(map[string]interface{})
+		if !ok || len(ma) != len(mb) {
+			return false
+		}
+		for k, v := range ma {
+			w, ok := mb[k]
+			if !ok || !jsonValuesEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		aa := a.([]interface{})
+		ab, ok := b.([]interface{})
+		if !ok || len(aa) != len(ab) {
+			return false
+		}
+		for i := range aa {
+			if !jsonValuesEqual(aa[i], ab[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
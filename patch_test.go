@@ -0,0 +1,132 @@
+package ripple
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	type MergePatchTest struct {
+		doc      string
+		patch    string
+		expected string
+	}
+	// Examples from RFC 7396, appendix A
+	var mergePatchTests = []MergePatchTest{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, d := range mergePatchTests {
+		output, err := MergePatch([]byte(d.doc), []byte(d.patch))
+		if err != nil {
+			t.Errorf("%s %s: Unexpected error: %s", d.doc, d.patch, err)
+		}
+		if string(output) != d.expected {
+			t.Errorf("%s %s: Expected %s, got %s", d.doc, d.patch, d.expected, string(output))
+		}
+	}
+}
+
+func TestJsonPatch(t *testing.T) {
+	type JsonPatchTest struct {
+		doc      string
+		patch    string
+		expected string
+		err      string
+	}
+	var jsonPatchTests = []JsonPatchTest{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, ""},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, ""},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"baz"}]`, `{"foo":["bar","baz"]}`, ""},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, ""},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, ""},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, ""},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, ""},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, ""},
+		{`{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"baz":{"bar":1},"foo":{"bar":1}}`, ""},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"test","path":"/a~1b","value":1},{"op":"test","path":"/m~0n","value":2.0}]`, `{"a/b":1,"m~n":2}`, ""},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, ""},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, "operation 0 (test): /baz: test failed"},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, "operation 0 (add): /baz/bat: path not found"},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":1}]`, ``, "operation 0 (add): /foo/2: array index out of bounds"},
+		{`{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/01"}]`, ``, "operation 0 (remove): /foo/01: invalid array index \"01\""},
+		{`{"foo":1}`, `[{"op":"add","path":"/a","value":1},{"op":"remove","path":"/nothere"}]`, ``, "operation 1 (remove): /nothere: path not found"},
+		{`{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, ``, "operation 0 (move): /foo/bar/baz: cannot move a value into one of its children"},
+		{`{"foo":1}`, `[{"op":"unknown","path":"/foo"}]`, ``, "operation 0 (unknown): /foo: unknown operation \"unknown\""},
+		{`{"foo":1}`, `[{"op":"add","path":"/foo"}]`, ``, "operation 0 (add): /foo: missing \"value\""},
+		{`{"foo":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, ""},
+		{`{"foo":1}`, `[{"op":"add","path":"/bar","value":null}]`, `{"bar":null,"foo":1}`, ""},
+	}
+	for _, d := range jsonPatchTests {
+		output, err := JsonPatch([]byte(d.doc), []byte(d.patch))
+		errString := ""
+		if err != nil {
+			errString = err.Error()
+		}
+		if errString != d.err {
+			t.Errorf("%s %s: Expected error '%s', got '%s'", d.doc, d.patch, d.err, errString)
+		}
+		if err == nil && string(output) != d.expected {
+			t.Errorf("%s %s: Expected %s, got %s", d.doc, d.patch, d.expected, string(output))
+		}
+	}
+}
+
+func TestContextApplyPatch(t *testing.T) {
+	type User struct {
+		Id      int
+		Name    string
+		Friends []int `json:",omitempty"`
+	}
+
+	newContext := func(contentType string, body string) *Context {
+		ctx := NewContext()
+		ctx.Request, _ = http.NewRequest("PATCH", "/users/1", strings.NewReader(body))
+		ctx.Request.Header.Set("Content-Type", contentType)
+		return ctx
+	}
+
+	user := User{Id: 1, Name: "John", Friends: []int{2, 3}}
+	ctx := newContext("application/merge-patch+json", `{"Name":"Paul","Friends":null}`)
+	err := ctx.ApplyPatch(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Id != 1 || user.Name != "Paul" || user.Friends != nil {
+		t.Errorf("Unexpected result: %v", user)
+	}
+
+	ctx = newContext("application/json-patch+json; charset=utf-8", `[{"op":"test","path":"/Name","value":"George"}]`)
+	err = ctx.ApplyPatch(&user)
+	patchErr, ok := err.(*PatchError)
+	if !ok || patchErr.Status != http.StatusConflict || patchErr.Index != 0 {
+		t.Errorf("Expected failed test error, got %v", err)
+	}
+
+	raw := json.RawMessage(`{"a":1}`)
+	ctx = newContext("application/json-patch+json", `[{"op":"add","path":"/b","value":2}]`)
+	err = ctx.ApplyPatch(&raw)
+	if err != nil || string(raw) != `{"a":1,"b":2}` {
+		t.Errorf("Unexpected result: %s, %v", string(raw), err)
+	}
+
+	ctx = newContext("application/json", `{}`)
+	err = ctx.ApplyPatch(&user)
+	if err != ErrUnsupportedPatchType {
+		t.Errorf("Expected %s, got %v", ErrUnsupportedPatchType, err)
+	}
+}
@@ -0,0 +1,128 @@
+package ripple
+
+import (
+	"log"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Sets the status used to redirect the requests whose path ends with a slash
+// to the same path without it, for example from "/users/1/" to "/users/1".
+// The status can be 301 (Moved Permanently), 308 (Permanent Redirect), which
+// keeps the request method and body, or 0, the default, to route these
+// requests as if they had no trailing slash. Only the requests that match a
+// route are redirected.
+func (this *Application) SetTrailingSlashRedirect(status int) {
+	if status != 0 && status != 301 && status != 308 {
+		log.Panicf("Invalid trailing slash redirect status: %d", status)
+	}
+	this.trailingSlashRedirect = status
+}
+
+// Returns the status used to redirect the requests with a trailing slash, or
+// 0 if they are not redirected.
+func (this *Application) TrailingSlashRedirect() int {
+	return this.trailingSlashRedirect
+}
+
+// Sets whether the controller names, action names and other static parts of
+// the routes are matched regardless of case (disabled by default). The
+// parameters keep the case of the request.
+func (this *Application) SetCaseInsensitive(v bool) {
+	this.caseInsensitive = v
+}
+
+// Tells whether routes are matched regardless of case.
+func (this *Application) CaseInsensitive() bool {
+	return this.caseInsensitive
+}
+
+// Returns the decoded segments of the request path, relative to the base
+// URL. The segments are split on the escaped path, so that an encoded slash
+// ("%2F") is part of a segment, and the empty and dot segments are removed.
+// Also returns the URL to redirect to if the path has a trailing slash and
+// trailing slash redirects are enabled. Returns false if the path is not
+// within the base URL or is not properly escaped.
+func (this *Application) requestPathTokens(u *url.URL) ([]string, string, bool) {
+	var escaped []string
+	for _, segment := range strings.Split(u.EscapedPath(), "/") {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, "", false
+		}
+		switch decoded {
+		case "", ".":
+		case "..":
+			if len(escaped) > 0 {
+				escaped = escaped[:len(escaped)-1]
+			}
+		default:
+			escaped = append(escaped, segment)
+		}
+	}
+
+	baseTokens := splitPath(this.parsedBaseUrl.Path)
+	if len(escaped) < len(baseTokens) {
+		return nil, "", false
+	}
+	var output []string
+	for i, segment := range escaped {
+		decoded, _ := url.PathUnescape(segment)
+		if i >= len(baseTokens) {
+			output = append(output, decoded)
+		} else if decoded != baseTokens[i] && !(this.caseInsensitive && strings.EqualFold(decoded, baseTokens[i])) {
+			return nil, "", false
+		}
+	}
+
+	redirectUrl := ""
+	if this.trailingSlashRedirect != 0 && len(output) > 0 && strings.HasSuffix(u.EscapedPath(), "/") {
+		redirect := url.URL{RawPath: "/" + strings.Join(escaped, "/"), RawQuery: u.RawQuery}
+		redirect.Path, _ = url.PathUnescape(redirect.RawPath)
+		redirectUrl = redirect.String()
+	}
+	return output, redirectUrl, true
+}
+
+// Returns the controller registered with the given name. If matching is case
+// insensitive and there is no exact match, the name is compared regardless of
+// case. Also returns the name under which the controller is registered.
+func (this *Application) findController(name string) (string, interface{}, bool) {
+	if controller, ok := this.controllers[name]; ok {
+		return name, controller, true
+	}
+	if this.caseInsensitive {
+		for controllerName, controller := range this.controllers {
+			if strings.EqualFold(controllerName, name) {
+				return controllerName, controller, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// Returns the name of the controller method that handles the action. If
+// matching is case insensitive and there is no exact match, the action name
+// is compared regardless of case with the actions of the controller. Also
+// returns the action name as it is spelled in the method name.
+func (this *Application) findActionMethod(controllerVal reflect.Value, requestMethod string, actionName string) (string, string, bool) {
+	methodName := makeMethodName(requestMethod, actionName)
+	if controllerVal.MethodByName(methodName).IsValid() {
+		return methodName, actionName, true
+	}
+	if this.caseInsensitive {
+		controllerType := controllerVal.Type()
+		for i := 0; i < controllerType.NumMethod(); i++ {
+			method := controllerType.Method(i)
+			if !isActionMethod(method) {
+				continue
+			}
+			methodRequestMethod, methodActionName, _ := parseMethodName(method.Name)
+			if methodRequestMethod == strings.ToUpper(requestMethod) && strings.EqualFold(methodActionName, actionName) {
+				return method.Name, methodActionName, true
+			}
+		}
+	}
+	return "", "", false
+}
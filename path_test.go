@@ -0,0 +1,114 @@
+package ripple
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type ControllerPathTesters struct{}
+
+func (this *ControllerPathTesters) GetFriendRequests(ctx *Context) {}
+
+func TestMatchRequestPath(t *testing.T) {
+	type testCase struct {
+		baseUrl         string
+		caseInsensitive bool
+		url             string
+		success         bool
+		controller      string
+		action          string
+		params          map[string]string
+	}
+
+	testCases := []testCase{
+		{"/api/", false, "/api", false, "", "", nil},
+		{"/api/", false, "/ap", false, "", "", nil},
+		{"/api/", false, "/apix/testers/1", false, "", "", nil},
+		{"/api/", false, "/other/testers/1", false, "", "", nil},
+		{"/api/", false, "/api/testers/1", true, "testers", "", map[string]string{"id": "1"}},
+		{"/api", false, "/api/testers/1", true, "testers", "", map[string]string{"id": "1"}},
+		{"/api/", false, "/api//testers/./1", true, "testers", "", map[string]string{"id": "1"}},
+		{"/api/", false, "/api/testers/2/../1", true, "testers", "", map[string]string{"id": "1"}},
+		{"/api/", false, "/api/../api/testers/1", true, "testers", "", map[string]string{"id": "1"}},
+		{"/api/", false, "/api/../testers/1", false, "", "", nil},
+		{"/api/", false, "/api/testers/%2E%2E/1", false, "", "", nil},
+		{"/api/", false, "/api/testers/a%2Fb", true, "testers", "", map[string]string{"id": "a/b"}},
+		{"/api/", false, "/api/testers/a%20b/tasks", true, "testers", "tasks", map[string]string{"id": "a b"}},
+		{"/", false, "/Testers/1", false, "", "", nil},
+		{"/", false, "/testers/1/TASKS", false, "", "", nil},
+		{"/", true, "/Testers/Ab/TASKS", true, "testers", "tasks", map[string]string{"id": "Ab"}},
+		{"/api/", true, "/API/misc", true, "other", "other", map[string]string{}},
+		{"/api/", false, "/api/MISC", false, "", "", nil},
+		{"/", true, "/users/1/friendRequests", true, "users", "friendRequests", map[string]string{"id": "1"}},
+		{"/", true, "/users/1/FRIENDREQUESTS", true, "users", "friendRequests", map[string]string{"id": "1"}},
+		{"/", false, "/users/1/friendrequests", false, "", "", nil},
+	}
+
+	for i, d := range testCases {
+		app := NewApplication()
+		app.SetBaseUrl(d.baseUrl)
+		app.SetCaseInsensitive(d.caseInsensitive)
+		app.RegisterController("testers", &ControllerTesters{})
+		app.RegisterController("other", &ControllerTesters4{})
+		app.RegisterController("users", &ControllerPathTesters{})
+		app.AddRoute(Route{Pattern: ":_controller/:id"})
+		app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+		app.AddRoute(Route{Pattern: "misc", Controller: "other", Action: "other"})
+
+		request := httptest.NewRequest("GET", d.url, nil)
+		result := app.matchRequest(request)
+		if result.Success != d.success {
+			t.Errorf("Test %d: Expected %t, got %t", i, d.success, result.Success)
+		}
+		if result.ControllerName != d.controller {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.controller, result.ControllerName)
+		}
+		if result.ActionName != d.action {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.action, result.ActionName)
+		}
+		if d.success && !reflect.DeepEqual(result.Params, d.params) {
+			t.Errorf("Test %d: Expected %v, got %v", i, d.params, result.Params)
+		}
+	}
+}
+
+func TestTrailingSlashRedirect(t *testing.T) {
+	type testCase struct {
+		status   int
+		method   string
+		url      string
+		expected int
+		location string
+	}
+
+	testCases := []testCase{
+		{0, "GET", "/api/testers/1/", http.StatusOK, ""},
+		{301, "GET", "/api/testers/1/", http.StatusMovedPermanently, "/api/testers/1"},
+		{301, "GET", "/api/testers/1", http.StatusOK, ""},
+		{301, "GET", "/api/", http.StatusNotFound, ""},
+		{301, "GET", "/api/nope/1/", http.StatusNotFound, ""},
+		{308, "POST", "/api/testers/a%2Fb//?x=1", http.StatusPermanentRedirect, "/api/testers/a%2Fb?x=1"},
+		{308, "GET", "/api/testers/./1/tasks/", http.StatusPermanentRedirect, "/api/testers/1/tasks"},
+	}
+
+	for i, d := range testCases {
+		app := NewApplication()
+		app.SetBaseUrl("/api/")
+		app.SetTrailingSlashRedirect(d.status)
+		app.RegisterController("testers", &ControllerTesters{})
+		app.AddRoute(Route{Pattern: ":_controller"})
+		app.AddRoute(Route{Pattern: ":_controller/:id"})
+		app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, httptest.NewRequest(d.method, d.url, nil))
+		if recorder.Code != d.expected {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.expected, recorder.Code)
+		}
+		if recorder.Header().Get("Location") != d.location {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.location, recorder.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ripple
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Implemented by the controllers whose resources are versioned, so that
+// clients can update them safely. Before running a PUT, PATCH or DELETE
+// action of such a controller, the application looks up the current version
+// of the resource and checks it against the If-Match or If-Unmodified-Since
+// header of the request. If it does not match, the client receives a
+// 412 Precondition Failed response and the action does not run. If the
+// request has neither header, the client receives a 428 Precondition
+// Required response (see Application.SetPreconditionRequired()).
+//
+//	func (this *UserController) ResourceVersion(ctx *ripple.Context) (string, time.Time, bool) {
+//		userId, _ := strconv.Atoi(ctx.Params["id"])
+//		user, exists := this.userCollection.Find(userId)
+//		return strconv.Itoa(user.Version), time.Time{}, exists
+//	}
+type VersionProvider interface {
+	// Returns the current ETag and last modification time of the resource
+	// targeted by the request, and whether the resource exists. Either the
+	// ETag or the time can be empty.
+	ResourceVersion(ctx *Context) (etag string, lastModified time.Time, exists bool)
+}
+
+// Sets whether the PUT, PATCH and DELETE requests on the resources of a
+// VersionProvider controller must include an If-Match or If-Unmodified-Since
+// header (default to true). Requests that create a resource, that is whose
+// resource does not exist yet, are not concerned.
+func (this *Application) SetPreconditionRequired(v bool) {
+	this.preconditionRequired = v
+}
+
+// Tells whether preconditions are required.
+func (this *Application) PreconditionRequired() bool {
+	return this.preconditionRequired
+}
+
+// Checks the preconditions of the request and, if they fail, sets the
+// error response and returns false.
+func (this *Application) checkPreconditions(ctx *Context, controller interface{}) bool {
+	method := ctx.Request.Method
+	if method != "PUT" && method != "PATCH" && method != "DELETE" {
+		return true
+	}
+	provider, ok := controller.(VersionProvider)
+	if !ok {
+		return true
+	}
+
+	etag, lastModified, exists := provider.ResourceVersion(ctx)
+	if etag != "" {
+		etag = quoteETag(etag)
+	}
+	ifMatch := ctx.Request.Header.Get("If-Match")
+	ifUnmodifiedSince := ctx.Request.Header.Get("If-Unmodified-Since")
+
+	if ifMatch != "" {
+		matched := exists && (strings.TrimSpace(ifMatch) == "*" || matchETag(ifMatch, etag, false))
+		if !matched {
+			ctx.Error(http.StatusPreconditionFailed, "")
+			return false
+		}
+		return true
+	}
+
+	// An invalid date must be ignored, and so must the header if the
+	// resource has no modification date, including when it does not exist
+	// (RFC 9110, section 13.1.4).
+	since, err := http.ParseTime(ifUnmodifiedSince)
+	if ifUnmodifiedSince != "" && err == nil && exists && !lastModified.IsZero() {
+		if lastModified.Truncate(time.Second).After(since) {
+			ctx.Error(http.StatusPreconditionFailed, "")
+			return false
+		}
+		return true
+	}
+
+	if exists && this.preconditionRequired {
+		ctx.Error(http.StatusPreconditionRequired, "")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package ripple
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var preconditionTestTime = time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+
+type ControllerVersionTesters struct {
+	Versions map[string]int
+	Updated  bool
+}
+
+func (this *ControllerVersionTesters) Get(ctx *Context) {}
+
+func (this *ControllerVersionTesters) Put(ctx *Context) {
+	this.Updated = true
+}
+
+func (this *ControllerVersionTesters) Delete(ctx *Context) {
+	this.Updated = true
+}
+
+func (this *ControllerVersionTesters) ResourceVersion(ctx *Context) (string, time.Time, bool) {
+	version, exists := this.Versions[ctx.Params["id"]]
+	return strconv.Itoa(version), preconditionTestTime, exists
+}
+
+func TestPreconditions(t *testing.T) {
+	controller := &ControllerVersionTesters{Versions: map[string]int{"1": 5}}
+	app := NewApplication()
+	app.RegisterController("testers", controller)
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+
+	type PreconditionTest struct {
+		method  string
+		url     string
+		header  string
+		value   string
+		status  int
+		updated bool
+	}
+	var preconditionTests = []PreconditionTest{
+		{"GET", "/testers/1", "", "", http.StatusOK, false},
+		{"PUT", "/testers/1", "", "", http.StatusPreconditionRequired, false},
+		{"PUT", "/testers/1", "If-Match", "\"5\"", http.StatusOK, true},
+		{"PUT", "/testers/1", "If-Match", "\"4\", \"5\"", http.StatusOK, true},
+		{"PUT", "/testers/1", "If-Match", "\"4\"", http.StatusPreconditionFailed, false},
+		{"PUT", "/testers/1", "If-Match", "W/\"5\"", http.StatusPreconditionFailed, false},
+		{"PUT", "/testers/1", "If-Match", "\"5-gzip\"", http.StatusOK, true},
+		{"PUT", "/testers/1", "If-Match", "*", http.StatusOK, true},
+		{"DELETE", "/testers/1", "If-Unmodified-Since", preconditionTestTime.Format(http.TimeFormat), http.StatusOK, true},
+		{"DELETE", "/testers/1", "If-Unmodified-Since", preconditionTestTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusPreconditionFailed, false},
+		{"DELETE", "/testers/1", "If-Unmodified-Since", "not a date", http.StatusPreconditionRequired, false},
+		{"PUT", "/testers/2", "", "", http.StatusOK, true},
+		{"PUT", "/testers/2", "If-Match", "*", http.StatusPreconditionFailed, false},
+		{"PUT", "/testers/2", "If-Unmodified-Since", preconditionTestTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, true},
+	}
+	for _, d := range preconditionTests {
+		controller.Updated = false
+		var reader io.Reader
+		request, _ := http.NewRequest(d.method, d.url, reader)
+		if d.header != "" {
+			request.Header.Set(d.header, d.value)
+		}
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != d.status {
+			t.Errorf("%s %s %s: Expected %d, got %d", d.method, d.url, d.value, d.status, ctx.Response.Status)
+		}
+		if controller.Updated != d.updated {
+			t.Errorf("%s %s %s: Expected updated = %t", d.method, d.url, d.value, d.updated)
+		}
+	}
+
+	app.SetPreconditionRequired(false)
+	var reader io.Reader
+	request, _ := http.NewRequest("PUT", "/testers/1", reader)
+	ctx := app.Dispatch(request)
+	if ctx.Response.Status != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, ctx.Response.Status)
+	}
+}
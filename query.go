@@ -0,0 +1,307 @@
+package ripple
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A field of the "sort" query parameter.
+type SortField struct {
+	Name       string
+	Descending bool
+}
+
+// A "filter[field]" or "filter[field][operator]" query parameter.
+type Filter struct {
+	Field string
+	// One of "eq" (the default), "ne", "lt", "lte", "gt", "gte", "in" or
+	// "contains". Interpreting it is up to the action.
+	Operator string
+	Value    string
+}
+
+var filterOperators = []string{"eq", "ne", "lt", "lte", "gt", "gte", "in", "contains"}
+
+// The sorting, field selection and filtering parameters of a request, as
+// parsed by Context.Query(). For example, "?sort=-name,id&fields=id,name&
+// filter[name]=John&filter[age][gte]=18".
+type Query struct {
+	Sort    []SortField
+	Fields  []string
+	Filters []Filter
+}
+
+// Returns the value of the filter with the given field and operator.
+func (this *Query) Filter(field string, operator string) (string, bool) {
+	for _, filter := range this.Filters {
+		if filter.Field == field && filter.Operator == operator {
+			return filter.Value, true
+		}
+	}
+	return "", false
+}
+
+// Tells whether the field has been requested. If no field has been requested,
+// all of them are.
+func (this *Query) HasField(name string) bool {
+	if len(this.Fields) == 0 {
+		return true
+	}
+	return containsFold(this.Fields, name)
+}
+
+// The sort, fields and filter parameters accepted by an action.
+type QueryRules struct {
+	Sort    []string
+	Fields  []string
+	Filters []string
+}
+
+// Implemented by the controllers that restrict the sort, fields and filter
+// parameters of their actions. For example:
+//
+//	func (this *UserController) QueryRules() map[string]ripple.QueryRules {
+//		return map[string]ripple.QueryRules{
+//			"Get": {
+//				Sort:    []string{"id", "name"},
+//				Fields:  []string{"id", "name", "email"},
+//				Filters: []string{"name"},
+//			},
+//		}
+//	}
+//
+// When rules apply to an action, a parameter that refers to a field that is
+// not listed makes Context.Query() fail. The field names are case
+// insensitive.
+type QueryProvider interface {
+	// Returns the rules indexed by method name, such as "Get". The rules with
+	// the "*" key apply to the actions that do not have rules of their own.
+	// The actions without rules accept any field.
+	QueryRules() map[string]QueryRules
+}
+
+// Returned by Context.Query() when a parameter is not valid.
+type QueryError struct {
+	// The name of the query parameter, such as "sort" or "filter[name]".
+	Parameter string
+	Message   string
+}
+
+func (this *QueryError) Error() string {
+	return this.Parameter + ": " + this.Message
+}
+
+// Parses the sort, fields and filter parameters of the request, and checks
+// them against the rules of the action if the controller implements
+// QueryProvider. Returns a *QueryError if a parameter is not valid, in which
+// case the action would usually respond with a 400 Bad Request.
+func (this *Context) Query() (*Query, error) {
+	values := this.Request.URL.Query()
+	output := new(Query)
+
+	for _, name := range splitList(values.Get("sort")) {
+		field := SortField{Name: name}
+		if strings.HasPrefix(name, "-") {
+			field.Name = name[1:]
+			field.Descending = true
+		} else if strings.HasPrefix(name, "+") {
+			field.Name = name[1:]
+		}
+		if field.Name == "" {
+			return nil, &QueryError{"sort", "empty field name"}
+		}
+		output.Sort = append(output.Sort, field)
+	}
+
+	output.Fields = splitList(values.Get("fields"))
+
+	for parameter, parameterValues := range values {
+		if !strings.HasPrefix(parameter, "filter[") {
+			continue
+		}
+		filter, ok := parseFilter(parameter)
+		if !ok {
+			return nil, &QueryError{parameter, "invalid filter"}
+		}
+		if !containsString(filterOperators, filter.Operator) {
+			return nil, &QueryError{parameter, fmt.Sprintf("unknown operator \"%s\"", filter.Operator)}
+		}
+		filter.Value = parameterValues[0]
+		output.Filters = append(output.Filters, filter)
+	}
+	sort.Slice(output.Filters, func(i, j int) bool {
+		if output.Filters[i].Field != output.Filters[j].Field {
+			return output.Filters[i].Field < output.Filters[j].Field
+		}
+		return output.Filters[i].Operator < output.Filters[j].Operator
+	})
+
+	rules := this.queryRules()
+	if rules == nil {
+		return output, nil
+	}
+	for _, field := range output.Sort {
+		if !containsFold(rules.Sort, field.Name) {
+			return nil, &QueryError{"sort", fmt.Sprintf("cannot sort by \"%s\"", field.Name)}
+		}
+	}
+	for _, field := range output.Fields {
+		if !containsFold(rules.Fields, field) {
+			return nil, &QueryError{"fields", fmt.Sprintf("unknown field \"%s\"", field)}
+		}
+	}
+	for _, filter := range output.Filters {
+		if !containsFold(rules.Filters, filter.Field) {
+			return nil, &QueryError{"filter[" + filter.Field + "]", fmt.Sprintf("cannot filter by \"%s\"", filter.Field)}
+		}
+	}
+	return output, nil
+}
+
+// Returns the query rules of the matched action, or nil if there are none.
+func (this *Context) queryRules() *QueryRules {
+	if !this.match.Success {
+		return nil
+	}
+	provider, ok := this.match.ControllerValue.Interface().(QueryProvider)
+	if !ok {
+		return nil
+	}
+	rules := provider.QueryRules()
+	if output, ok := rules[makeMethodName(this.Request.Method, this.match.ActionName)]; ok {
+		return &output
+	}
+	if output, ok := rules["*"]; ok {
+		return &output
+	}
+	return nil
+}
+
+// Removes from the response body the fields that have not been requested
+// with the "fields" query parameter. The body must serialize to a JSON object
+// or to an array of objects. For a Page, the fields are selected in each
+// item. Call it at the end of the action, once the body has been set:
+//
+//	func (this *UserController) Get(ctx *ripple.Context) {
+//		ctx.Response.Body = this.userCollection.Get(userId)
+//		err := ctx.SelectFields()
+//		if err != nil {
+//			ctx.Error(http.StatusBadRequest, err.Error())
+//		}
+//	}
+func (this *Context) SelectFields() error {
+	query, err := this.Query()
+	if err != nil {
+		return err
+	}
+	if len(query.Fields) == 0 || this.Response.Body == nil {
+		return nil
+	}
+
+	if page, ok := this.Response.Body.(*Page); ok {
+		items, err := selectFields(page.Items, query.Fields)
+		if err != nil {
+			return err
+		}
+		selected := *page
+		selected.Items = items
+		this.Response.Body = &selected
+		return nil
+	}
+
+	body, err := selectFields(this.Response.Body, query.Fields)
+	if err != nil {
+		return err
+	}
+	this.Response.Body = body
+	return nil
+}
+
+// Serializes the value to JSON, removes the fields that are not in the list,
+// and returns the resulting JSON.
+func selectFields(value interface{}, fields []string) (json.RawMessage, error) {
+	var data []byte
+	var err error
+	if s, ok := value.(string); ok {
+		data = []byte(s)
+	} else {
+		data, err = json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	doc, err := decodeJson(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		selectObjectFields(v, fields)
+	case []interface{}:
+		for _, item := range v {
+			if object, ok := item.(map[string]interface{}); ok {
+				selectObjectFields(object, fields)
+			}
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func selectObjectFields(object map[string]interface{}, fields []string) {
+	for name := range object {
+		if !containsFold(fields, name) {
+			delete(object, name)
+		}
+	}
+}
+
+// Parses "filter[field]" or "filter[field][operator]".
+func parseFilter(parameter string) (Filter, bool) {
+	var output Filter
+	var parts []string
+	rest := parameter[len("filter"):]
+	for rest != "" {
+		if rest[0] != '[' {
+			return output, false
+		}
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return output, false
+		}
+		parts = append(parts, rest[1:end])
+		rest = rest[end+1:]
+	}
+	if len(parts) < 1 || len(parts) > 2 || parts[0] == "" {
+		return output, false
+	}
+	output.Field = parts[0]
+	output.Operator = "eq"
+	if len(parts) == 2 {
+		output.Operator = strings.ToLower(parts[1])
+	}
+	return output, true
+}
+
+// Splits a comma-separated list, ignoring the empty items.
+func splitList(s string) []string {
+	var output []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			output = append(output, item)
+		}
+	}
+	return output
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package ripple
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type queryTestUser struct {
+	Id    int
+	Name  string
+	Email string
+}
+
+type ControllerQueryTester struct{}
+
+func (this *ControllerQueryTester) Get(ctx *Context) {
+	ctx.Response.Body = []queryTestUser{{1, "John", "john@example.com"}, {2, "Jane", "jane@example.com"}}
+	err := ctx.SelectFields()
+	if err != nil {
+		ctx.Error(http.StatusBadRequest, err.Error())
+	}
+}
+
+func (this *ControllerQueryTester) GetFriends(ctx *Context) {
+	ctx.SetPage(NewPage([]queryTestUser{{3, "Bob", "bob@example.com"}}, &Pagination{Page: 1, Limit: 10}, 1))
+	err := ctx.SelectFields()
+	if err != nil {
+		ctx.Error(http.StatusBadRequest, err.Error())
+	}
+}
+
+func (this *ControllerQueryTester) QueryRules() map[string]QueryRules {
+	return map[string]QueryRules{
+		"Get": {
+			Sort:    []string{"id", "name"},
+			Fields:  []string{"id", "name"},
+			Filters: []string{"name", "age"},
+		},
+	}
+}
+
+func TestQuery(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("users", &ControllerQueryTester{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+
+	type testCase struct {
+		url      string
+		expected *Query
+		success  bool
+	}
+
+	testCases := []testCase{
+		{"/users", &Query{}, true},
+		{
+			"/users?sort=-name,+id&fields=id,name&filter[name]=John&filter[age][gte]=18",
+			&Query{
+				Sort:    []SortField{{"name", true}, {"id", false}},
+				Fields:  []string{"id", "name"},
+				Filters: []Filter{{"age", "gte", "18"}, {"name", "eq", "John"}},
+			},
+			true,
+		},
+		{"/users?sort=Name", &Query{Sort: []SortField{{"Name", false}}}, true},
+		{"/users?sort=email", nil, false},
+		{"/users?fields=email", nil, false},
+		{"/users?filter[email]=a", nil, false},
+		{"/users?filter[name][near]=a", nil, false},
+		{"/users?filter[name", nil, false},
+		{"/users?filter[]=a", nil, false},
+		{"/users?sort=-", nil, false},
+		{"/users/1/friends?sort=email&fields=email", &Query{Sort: []SortField{{"email", false}}, Fields: []string{"email"}}, true},
+	}
+
+	for i, d := range testCases {
+		request, _ := http.NewRequest("GET", d.url, nil)
+		ctx := NewContext()
+		ctx.Request = request
+		ctx.match = app.matchRequest(request)
+		query, err := ctx.Query()
+		if (err == nil) != d.success {
+			t.Errorf("Test %d: Expected success %t, got error %v", i, d.success, err)
+			continue
+		}
+		if d.success && !reflect.DeepEqual(query, d.expected) {
+			t.Errorf("Test %d: Expected %v, got %v", i, d.expected, query)
+		}
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("users", &ControllerQueryTester{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+
+	type testCase struct {
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}
+
+	testCases := []testCase{
+		{"/users", http.StatusOK, "[{\"Id\":1,\"Name\":\"John\",\"Email\":\"john@example.com\"},{\"Id\":2,\"Name\":\"Jane\",\"Email\":\"jane@example.com\"}]"},
+		{"/users?fields=id,name", http.StatusOK, "[{\"Id\":1,\"Name\":\"John\"},{\"Id\":2,\"Name\":\"Jane\"}]"},
+		{"/users?fields=email", http.StatusBadRequest, ""},
+		{"/users/3/friends?fields=email", http.StatusOK, "{\"Items\":[{\"Email\":\"bob@example.com\"}],\"Page\":1,\"Limit\":10,\"Total\":1,\"PageCount\":1}"},
+	}
+
+	for i, d := range testCases {
+		request, _ := http.NewRequest("GET", d.url, nil)
+		ctx := app.Dispatch(request)
+		if ctx.Response.Status != d.expectedStatus {
+			t.Errorf("Test %d: Expected %d, got %d", i, d.expectedStatus, ctx.Response.Status)
+			continue
+		}
+		if d.expectedStatus != http.StatusOK {
+			continue
+		}
+		body, _ := app.serializeResponseBody(ctx.Response.Body)
+		if body != d.expectedBody {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.expectedBody, body)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package ripple
+
+import (
+	"hash/fnv"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The result of taking a token from a rate limit bucket.
+type RateLimitResult struct {
+	// Whether the request is allowed.
+	Allowed bool
+	// The number of requests that can still be made right away.
+	Remaining int
+	// If the request is not allowed, how long until it can be retried.
+	RetryAfter time.Duration
+	// How long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Stores the rate limit buckets. NewMemoryRateLimitStore() builds an in-memory
+// store; other implementations can be used to share the limits between
+// several servers.
+type RateLimitStore interface {
+	// Takes a token from the bucket identified by key. The bucket holds at
+	// most burst tokens, and is refilled at the rate of limit tokens per period.
+	Take(key string, limit int, period time.Duration, burst int) (RateLimitResult, error)
+}
+
+// Returns the key that identifies the client of a request for rate limiting.
+// An empty key means that the request is not rate limited.
+type RateLimitKeyFunc func(ctx *Context) string
+
+// Identifies the clients by IP address.
+func RateLimitByIp(ctx *Context) string {
+	host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+	if err != nil {
+		return "ip:" + ctx.Request.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Identifies the clients by authenticated principal (see Auth), or by IP
+// address for the requests that are not authenticated.
+func RateLimitByPrincipal(ctx *Context) string {
+	if ctx.Principal() == nil {
+		return RateLimitByIp(ctx)
+	}
+	return "principal:" + ctx.Principal().Name
+}
+
+// Identifies the clients by the value of a header, for instance an API key
+// header, or by IP address for the requests that do not have this header.
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(ctx *Context) string {
+		value := ctx.Request.Header.Get(name)
+		if value == "" {
+			return RateLimitByIp(ctx)
+		}
+		return "header:" + name + ":" + value
+	}
+}
+
+// A middleware that limits the rate of requests per client, using a token
+// bucket for each client. Use NewRateLimiter() to build it, then register it
+// for the whole application, a controller or a route:
+//
+//	limiter := ripple.NewRateLimiter(100, time.Minute)
+//	limiter.Key = ripple.RateLimitByPrincipal
+//	app.UseController("users", limiter.Handle)
+//
+// The RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers are
+// sent with each response. When the limit is exceeded, the client receives a
+// 429 Too Many Requests response with a Retry-After header.
+type RateLimiter struct {
+	// The number of requests allowed per period.
+	Limit  int
+	Period time.Duration
+	// The maximum number of requests that can be made in a burst (default to Limit).
+	Burst int
+	// Identifies the clients (default to RateLimitByIp).
+	Key RateLimitKeyFunc
+	// Where the buckets are stored (default to an in-memory store).
+	Store RateLimitStore
+}
+
+// Build a new rate limiter allowing limit requests per period.
+func NewRateLimiter(limit int, period time.Duration) *RateLimiter {
+	output := new(RateLimiter)
+	output.Limit = limit
+	output.Period = period
+	output.Burst = limit
+	output.Key = RateLimitByIp
+	output.Store = NewMemoryRateLimitStore()
+	return output
+}
+
+// Implementation of Middleware.
+func (this *RateLimiter) Handle(ctx *Context, next func()) {
+	key := this.Key(ctx)
+	if key == "" {
+		next()
+		return
+	}
+
+	result, err := this.Store.Take(key, this.Limit, this.Period, this.Burst)
+	if err != nil {
+		// Better let the requests through than blocking all of them
+		// because the store is not available.
+		log.Printf("[%s] Rate limit store error: %s\n", ctx.RequestID(), err)
+		next()
+		return
+	}
+
+	header := ctx.Response.Header
+	header.Set("RateLimit-Limit", strconv.Itoa(this.Burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+	if !result.Allowed {
+		retryAfter := ceilSeconds(result.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		header.Set("Retry-After", strconv.Itoa(retryAfter))
+		ctx.Error(http.StatusTooManyRequests, "")
+		return
+	}
+
+	next()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+const rateLimitShardCount = 32
+
+type rateLimitBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimitShard struct {
+	mutex   sync.Mutex
+	buckets map[string]*rateLimitBucket
+	takes   int
+}
+
+// An in-memory RateLimitStore. The buckets are split into shards, each with
+// its own lock, to reduce contention. Full buckets are removed periodically.
+type MemoryRateLimitStore struct {
+	shards [rateLimitShardCount]rateLimitShard
+	now    func() time.Time
+}
+
+// Build a new in-memory rate limit store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	output := new(MemoryRateLimitStore)
+	for i := 0; i < len(output.shards); i++ {
+		output.shards[i].buckets = make(map[string]*rateLimitBucket)
+	}
+	output.now = time.Now
+	return output
+}
+
+func (this *MemoryRateLimitStore) shard(key string) *rateLimitShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &this.shards[h.Sum32()%rateLimitShardCount]
+}
+
+// Implementation of RateLimitStore.
+func (this *MemoryRateLimitStore) Take(key string, limit int, period time.Duration, burst int) (RateLimitResult, error) {
+	var output RateLimitResult
+	now := this.now()
+	rate := float64(limit) / period.Seconds()
+	capacity := float64(burst)
+
+	shard := this.shard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	shard.takes++
+	if shard.takes%1024 == 0 {
+		shard.removeFullBuckets(now, rate, capacity)
+	}
+
+	bucket, ok := shard.buckets[key]
+	if !ok {
+		bucket = &rateLimitBucket{tokens: capacity, last: now}
+		shard.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		output.Allowed = true
+	} else {
+		output.RetryAfter = secondsToDuration((1 - bucket.tokens) / rate)
+	}
+	output.Remaining = int(bucket.tokens)
+	output.Reset = secondsToDuration((capacity - bucket.tokens) / rate)
+	return output, nil
+}
+
+// The buckets that would be full by now can be removed since they would
+// be identical to new ones.
+func (this *rateLimitShard) removeFullBuckets(now time.Time, rate float64, capacity float64) {
+	for key, bucket := range this.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rate >= capacity {
+			delete(this.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
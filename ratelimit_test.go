@@ -0,0 +1,110 @@
+package ripple
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		r, _ := store.Take("a", 1, time.Second, 3)
+		if !r.Allowed || r.Remaining != 2-i {
+			t.Errorf("Take %d: Expected allowed with %d remaining, got %t/%d", i, 2-i, r.Allowed, r.Remaining)
+		}
+	}
+	r, _ := store.Take("a", 1, time.Second, 3)
+	if r.Allowed {
+		t.Errorf("Expected request to be limited")
+	}
+	if r.RetryAfter != time.Second {
+		t.Errorf("Expected %s, got %s", time.Second, r.RetryAfter)
+	}
+	if r.Reset != 3*time.Second {
+		t.Errorf("Expected %s, got %s", 3*time.Second, r.Reset)
+	}
+
+	r, _ = store.Take("b", 1, time.Second, 3)
+	if !r.Allowed {
+		t.Errorf("Buckets are not independent")
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	r, _ = store.Take("a", 1, time.Second, 3)
+	if !r.Allowed || r.Remaining != 0 {
+		t.Errorf("Expected allowed with 0 remaining, got %t/%d", r.Allowed, r.Remaining)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("limited", &ControllerTesters{})
+	app.RegisterController("free", &ControllerTesters{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+
+	limiter := NewRateLimiter(2, time.Minute)
+	limiter.Key = RateLimitByHeader("X-API-Key")
+	app.UseController("limited", limiter.Handle)
+
+	dispatch := func(url string, key string) *Context {
+		var reader io.Reader
+		request, _ := http.NewRequest("GET", url, reader)
+		request.RemoteAddr = "10.0.0.1:1234"
+		if key != "" {
+			request.Header.Set("X-API-Key", key)
+		}
+		return app.Dispatch(request)
+	}
+
+	for i := 0; i < 2; i++ {
+		ctx := dispatch("/limited", "key1")
+		if ctx.Response.Status != http.StatusOK {
+			t.Errorf("Expected %d, got %d", http.StatusOK, ctx.Response.Status)
+		}
+	}
+
+	ctx := dispatch("/limited", "key1")
+	if ctx.Response.Status != http.StatusTooManyRequests {
+		t.Errorf("Expected %d, got %d", http.StatusTooManyRequests, ctx.Response.Status)
+	}
+	if ctx.Response.Header.Get("Retry-After") != "30" {
+		t.Errorf("Expected %s, got %s", "30", ctx.Response.Header.Get("Retry-After"))
+	}
+	if ctx.Response.Header.Get("RateLimit-Limit") != "2" || ctx.Response.Header.Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Unexpected RateLimit headers: %v", ctx.Response.Header)
+	}
+
+	ctx = dispatch("/limited", "key2")
+	if ctx.Response.Status != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, ctx.Response.Status)
+	}
+
+	for i := 0; i < 3; i++ {
+		ctx = dispatch("/free", "key1")
+		if ctx.Response.Status != http.StatusOK {
+			t.Errorf("Expected %d, got %d", http.StatusOK, ctx.Response.Status)
+		}
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	var reader io.Reader
+	ctx := NewContext()
+	ctx.Request, _ = http.NewRequest("GET", "/", reader)
+	ctx.Request.RemoteAddr = "[::1]:1234"
+	if RateLimitByIp(ctx) != "ip:::1" {
+		t.Errorf("Expected %s, got %s", "ip:::1", RateLimitByIp(ctx))
+	}
+	if RateLimitByPrincipal(ctx) != "ip:::1" {
+		t.Errorf("Expected %s, got %s", "ip:::1", RateLimitByPrincipal(ctx))
+	}
+	ctx.SetPrincipal(&Principal{Name: "john"})
+	if RateLimitByPrincipal(ctx) != "principal:john" {
+		t.Errorf("Expected %s, got %s", "principal:john", RateLimitByPrincipal(ctx))
+	}
+}
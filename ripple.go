@@ -1,17 +1,29 @@
 package ripple
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // A context holds information about the current request and response.
 // An object of type Context is passed to methods of a controller.
+//
+// A Context also implements context.Context. It is derived from the context
+// of the HTTP request, so it is cancelled when the client disconnects or when
+// the request timeout is exceeded (see Application.SetTimeout()). It can be
+// passed as is to database drivers and other functions that accept a
+// context.Context.
 type Context struct {
 	// The parameters matched in the current URL. A parameter is defined
 	// in a route by prefixing it with a ":". For example, ":id", ":name".
@@ -20,6 +32,18 @@ type Context struct {
 	Request *http.Request
 	// The response object.
 	Response *Response
+	// The ID of the current request. See RequestID().
+	requestId string
+	// The standard context wrapped by this object.
+	stdContext context.Context
+	// The application dispatching the request, if any.
+	app *Application
+	// The result of matching the request against the routes.
+	match MatchRequestResult
+	// The authenticated client, if any. See Principal().
+	principal *Principal
+	// Called once the response body has been serialized by ServeHTTP().
+	serializeHooks []func(status int, size int)
 }
 
 // Build a new context object.
@@ -27,23 +51,152 @@ func NewContext() *Context {
 	output := new(Context)
 	output.Params = make(map[string]string)
 	output.Response = NewResponse()
+	output.stdContext = context.Background()
+	return output
+}
+
+// Implementation of context.Context.
+func (this *Context) Deadline() (time.Time, bool) {
+	return this.stdContext.Deadline()
+}
+
+// Implementation of context.Context.
+func (this *Context) Done() <-chan struct{} {
+	return this.stdContext.Done()
+}
+
+// Implementation of context.Context.
+func (this *Context) Err() error {
+	return this.stdContext.Err()
+}
+
+// Implementation of context.Context. Returns the value associated with the
+// key, as set by Set() or by the parent context.
+func (this *Context) Value(key interface{}) interface{} {
+	return this.stdContext.Value(key)
+}
+
+// Returns the application that is dispatching the request, or nil if the
+// context was not built by an application (for example in unit tests).
+func (this *Context) Application() *Application {
+	return this.app
+}
+
+// Returns the route, controller and action that match the current request.
+// If no route matches, Success is false.
+func (this *Context) Match() MatchRequestResult {
+	return this.match
+}
+
+// Returns the authenticated client of the request, or nil if the request
+// has not been authenticated. See Auth.
+func (this *Context) Principal() *Principal {
+	return this.principal
+}
+
+// Sets the authenticated client of the request. This is normally done by
+// the Auth middleware.
+func (this *Context) SetPrincipal(v *Principal) {
+	this.principal = v
+}
+
+// Adds a function called with the final status and the size of the body once
+// the response has been serialized. The function is not called for streamed
+// bodies, nor if the response is not served by ServeHTTP().
+func (this *Context) onSerialized(hook func(status int, size int)) {
+	this.serializeHooks = append(this.serializeHooks, hook)
+}
+
+// Associates a value with a key. This is mainly used by middleware to pass
+// data, such as the current user or tenant, to the controller actions. As for
+// context.WithValue(), the key should be of a type defined by the package
+// that sets the value, to avoid collisions. For example:
+//
+//	type userKey struct{}
+//	ctx.Set(userKey{}, user)
+//	user, ok := ctx.Value(userKey{}).(*User)
+func (this *Context) Set(key interface{}, value interface{}) {
+	this.stdContext = context.WithValue(this.stdContext, key, value)
+}
+
+// Returns the ID of the current request. The ID is read from the request
+// header set with Application.SetRequestIDHeader() ("X-Request-ID" by default)
+// or, if the client did not provide one, generated by the application. The
+// same ID is sent back in the response header, and is included in the log
+// lines and error bodies generated by the framework.
+func (this *Context) RequestID() string {
+	return this.requestId
+}
+
+// Sets the response to an error with the given status code. The body is
+// an ErrorBody object that includes the request ID. If message is empty,
+// the standard HTTP status text is used.
+func (this *Context) Error(status int, message string) {
+	body := newErrorBody(status, this.requestId)
+	if message != "" {
+		body.Error = message
+	}
+	this.Response.Status = status
+	this.Response.Body = body
+}
+
+// The body of the error responses generated by the framework, for example
+// when no route matches the request.
+type ErrorBody struct {
+	Error     string
+	RequestID string
+}
+
+func newErrorBody(status int, requestId string) ErrorBody {
+	var output ErrorBody
+	output.Error = http.StatusText(status)
+	output.RequestID = requestId
 	return output
 }
 
 // A Ripple application. Use NewApplication() to build it.
 type Application struct {
-	controllers map[string]interface{}
-	routes      []Route
-	contentType string
-	baseUrl     string
-	parsedBaseUrl *url.URL
+	controllers           map[string]interface{}
+	routes                []Route
+	contentType           string
+	baseUrl               string
+	parsedBaseUrl         *url.URL
+	requestIdHeader       string
+	timeout               time.Duration
+	middlewares           []Middleware
+	controllerMiddlewares map[string][]Middleware
+	policies              map[string]map[string]Policy
+	compression           *Compression
+	autoETag              bool
+	preconditionRequired  bool
+	trailingSlashRedirect int
+	caseInsensitive       bool
+	lifecycle             *lifecycle
+	health                *health
 }
 
+// A middleware runs around the controller actions. It receives the context
+// of the request and a function that runs the rest of the chain, that is
+// the next middleware or, for the last one, the action itself. The context
+// holds the matched route, if any (see Context.Match()), so a middleware
+// can inspect it before calling next. A middleware may also choose not to
+// call next, for instance to reply with an error. If no route matches the
+// request, the middlewares still run, and the end of the chain sets a
+// 404 error.
+type Middleware func(ctx *Context, next func())
+
 // Build a new application object.
 func NewApplication() *Application {
 	output := new(Application)
 	output.controllers = make(map[string]interface{})
+	output.controllerMiddlewares = make(map[string][]Middleware)
+	output.policies = make(map[string]map[string]Policy)
 	output.contentType = "application/json"
+	output.requestIdHeader = "X-Request-ID"
+	output.autoETag = true
+	output.preconditionRequired = true
+	output.lifecycle = newLifecycle()
+	output.health = newHealth()
 	output.SetBaseUrl("/")
 	return output
 }
@@ -54,6 +207,51 @@ type Route struct {
 	Pattern    string
 	Controller string
 	Action     string
+	// Maximum duration of the action. If zero, the application
+	// timeout is used. See Application.SetTimeout().
+	Timeout time.Duration
+	// Middlewares that only run for this route, after the application,
+	// controller and group middlewares.
+	Middlewares []Middleware
+	// The group the route has been added to, if any.
+	group *RouteGroup
+}
+
+// A group of routes that share a pattern prefix and some middlewares.
+// Use Application.Group() to build it.
+type RouteGroup struct {
+	app         *Application
+	parent      *RouteGroup
+	prefix      string
+	middlewares []Middleware
+}
+
+// Adds a middleware that runs for all the routes of the group, including
+// the routes that have already been added.
+func (this *RouteGroup) Use(middleware Middleware) {
+	this.middlewares = append(this.middlewares, middleware)
+}
+
+// Adds a route to the group. The group prefix is prepended to the pattern.
+func (this *RouteGroup) AddRoute(route Route) {
+	route.Pattern = strings.TrimRight(this.prefix, "/") + "/" + strings.TrimLeft(route.Pattern, "/")
+	route.group = this
+	this.app.AddRoute(route)
+}
+
+// Builds a sub-group. Its prefix is appended to the prefix of the current
+// group, and its middlewares run after the ones of the current group.
+func (this *RouteGroup) Group(prefix string) *RouteGroup {
+	output := this.app.Group(strings.TrimRight(this.prefix, "/") + "/" + strings.TrimLeft(prefix, "/"))
+	output.parent = this
+	return output
+}
+
+func (this *RouteGroup) allMiddlewares() []Middleware {
+	if this.parent == nil {
+		return this.middlewares
+	}
+	return append(this.parent.allMiddlewares(), this.middlewares...)
 }
 
 // Holds information about the HTTP response.
@@ -62,13 +260,25 @@ type Response struct {
 	Status int
 	// The response body. It will be serialized automatically
 	// by the Ripple application before being sent to the client.
+	// If it is an io.Reader, it is streamed to the client as is
+	// and closed afterwards if it is an io.Closer.
 	Body interface{}
+	// The HTTP headers to send along with the response.
+	Header http.Header
 }
 
 // Build a new response object.
 func NewResponse() *Response {
 	output := new(Response)
 	output.Body = nil
+	output.Header = make(http.Header)
+	return output
+}
+
+func (this *Response) clone() *Response {
+	output := new(Response)
+	*output = *this
+	output.Header = this.Header.Clone()
 	return output
 }
 
@@ -91,7 +301,8 @@ func defaultHttpStatus(method string) int {
 // instance if the base URL is "/api/" and the client does
 // a request on "/api/images/1", the application will dispatch
 // "images/1". Specifying the full URL (with domain, etc.) is
-// not necessary.
+// not necessary. Requests outside of the base URL, such as
+// "/images/1" or "/api/../images/1", get a 404 error.
 func (this *Application) SetBaseUrl(v string) {
 	this.baseUrl = v
 	var err error
@@ -106,6 +317,106 @@ func (this *Application) BaseUrl() string {
 	return this.baseUrl
 }
 
+// Sets the name of the header used to read the request ID from the incoming
+// request and to send it back in the response (default to "X-Request-ID").
+func (this *Application) SetRequestIDHeader(v string) {
+	this.requestIdHeader = v
+}
+
+// Returns the name of the request ID header.
+func (this *Application) RequestIDHeader() string {
+	return this.requestIdHeader
+}
+
+// Adds a middleware to the application. Middlewares run for every request,
+// in the order in which they have been added.
+func (this *Application) Use(middleware Middleware) {
+	this.middlewares = append(this.middlewares, middleware)
+}
+
+// Adds a middleware that only runs for the actions of the given controller,
+// after the application middlewares.
+func (this *Application) UseController(name string, middleware Middleware) {
+	this.controllerMiddlewares[name] = append(this.controllerMiddlewares[name], middleware)
+}
+
+// Builds a new group of routes. All the routes added to the group have their
+// pattern prefixed with the given prefix. For example:
+//
+//	admin := app.Group("admin")
+//	admin.Use(auth.Handle)
+//	admin.AddRoute(ripple.Route{Pattern: ":_controller/:id"})
+func (this *Application) Group(prefix string) *RouteGroup {
+	output := new(RouteGroup)
+	output.app = this
+	output.prefix = prefix
+	return output
+}
+
+// Returns the middlewares that run for the given match, in order: the
+// application ones, then the controller, group and route ones.
+func (this *Application) matchMiddlewares(r MatchRequestResult) []Middleware {
+	if !r.Success {
+		return this.middlewares
+	}
+	var output []Middleware
+	output = append(output, this.middlewares...)
+	output = append(output, this.controllerMiddlewares[r.ControllerName]...)
+	if r.MatchedRoute.group != nil {
+		output = append(output, r.MatchedRoute.group.allMiddlewares()...)
+	}
+	output = append(output, r.MatchedRoute.Middlewares...)
+	return output
+}
+
+// Sets the maximum duration of the controller actions (default to 0, meaning
+// no timeout). It can be overridden for a given route using Route.Timeout.
+// When the timeout is exceeded, the context passed to the action is cancelled
+// and the client receives a 503 Service Unavailable response. The action
+// should check ctx.Done() or pass ctx to the functions it calls so that it
+// stops as soon as possible.
+func (this *Application) SetTimeout(v time.Duration) {
+	this.timeout = v
+}
+
+// Returns the application timeout.
+func (this *Application) Timeout() time.Duration {
+	return this.timeout
+}
+
+// Returns the request ID provided by the client or, if there is none or
+// if it is not valid, generates a new one.
+func (this *Application) requestId(request *http.Request) string {
+	output := request.Header.Get(this.requestIdHeader)
+	if isValidRequestId(output) {
+		return output
+	}
+	return generateRequestId()
+}
+
+// Only accept reasonably short IDs made of printable ASCII characters, since
+// the ID ends up in the log lines and response headers.
+func isValidRequestId(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func generateRequestId() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Panicf("Could not generate request ID: %s", err)
+	}
+	return hex.EncodeToString(b)
+}
+
 // Helper function to prepare the response writter data for `ServeHTTP()`
 func (this *Application) prepareServeHttpResponseData(context *Context) serveHttpResponseData {
 	var statusCode int
@@ -119,7 +430,12 @@ func (this *Application) prepareServeHttpResponseData(context *Context) serveHtt
 	if context != nil {
 		body, err = this.serializeResponseBody(context.Response.Body)
 		if err != nil {
+			log.Printf("[%s] Could not serialize response body: %s\n", context.requestId, err)
 			statusCode = http.StatusInternalServerError
+			body, _ = this.serializeResponseBody(newErrorBody(statusCode, context.requestId))
+		}
+		for _, hook := range context.serializeHooks {
+			hook(statusCode, len(body))
 		}
 	}
 
@@ -131,11 +447,90 @@ func (this *Application) prepareServeHttpResponseData(context *Context) serveHtt
 
 // Serves an HTTP request - implementation of net.http.ServeHTTP
 func (this *Application) ServeHTTP(writter http.ResponseWriter, request *http.Request) {
+	if this.serveHealth(writter, request) {
+		return
+	}
+
 	context := this.Dispatch(request)
+	header := writter.Header()
+	for name, values := range context.Response.Header {
+		header[name] = values
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", this.contentType)
+	}
+
+	// If the body is a reader, it is streamed to the client as is.
+	if stream, ok := context.Response.Body.(io.Reader); ok {
+		if closer, ok := stream.(io.Closer); ok {
+			defer closer.Close()
+		}
+		if this.checkNotModified(request, header, context.Response.Status, nil) {
+			writeNotModified(writter)
+			return
+		}
+		this.writeResponse(writter, request, context.Response.Status, stream, -1)
+		return
+	}
+
 	r := this.prepareServeHttpResponseData(context)
-	writter.Header().Set("Content-Type", this.contentType)
-	writter.WriteHeader(r.Status)
-	writter.Write([]byte(r.Body))
+	if this.checkNotModified(request, header, r.Status, &r.Body) {
+		writeNotModified(writter)
+		return
+	}
+	this.writeResponse(writter, request, r.Status, strings.NewReader(r.Body), len(r.Body))
+}
+
+func writeNotModified(writter http.ResponseWriter) {
+	writter.Header().Del("Content-Type")
+	writter.Header().Del("Content-Length")
+	writter.WriteHeader(http.StatusNotModified)
+}
+
+// Writes the status and body, compressing the body if compression is
+// enabled. size is the size of the body, or -1 if it is streamed, in
+// which case the data is sent to the client as soon as it is read.
+func (this *Application) writeResponse(writter http.ResponseWriter, request *http.Request, status int, body io.Reader, size int) {
+	var output io.Writer = writter
+	flush := func() {
+		if flusher, ok := writter.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	if this.compression != nil {
+		compressor := this.compression.start(writter, request, status, size)
+		if compressor != nil {
+			defer compressor.Close()
+			output = compressor
+			flush = compressor.Flush
+		}
+	}
+
+	writter.WriteHeader(status)
+
+	if size >= 0 {
+		io.Copy(output, body)
+		return
+	}
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buffer)
+		if n > 0 {
+			_, writeErr := output.Write(buffer[0:n])
+			if writeErr != nil {
+				return
+			}
+			flush()
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Could not stream response body: %s\n", err)
+			}
+			return
+		}
+	}
 }
 
 func (this *Application) serializeResponseBody(body interface{}) (string, error) {
@@ -155,15 +550,15 @@ func (this *Application) serializeResponseBody(body interface{}) (string, error)
 
 	case int, int8, int16, int32, int64:
 
-		output = strconv.Itoa(body.(int))
+		output = strconv.FormatInt(reflect.ValueOf(body).Int(), 10)
 
 	case uint, uint8, uint16, uint32, uint64:
 
-		output = strconv.FormatUint(body.(uint64), 10)
+		output = strconv.FormatUint(reflect.ValueOf(body).Uint(), 10)
 
 	case float32, float64:
 
-		output = strconv.FormatFloat(body.(float64), 'f', -1, 64)
+		output = strconv.FormatFloat(reflect.ValueOf(body).Float(), 'f', -1, reflect.TypeOf(body).Bits())
 
 	case bool:
 
@@ -204,9 +599,13 @@ func (this *Application) checkRoute(route Route) {
 // Registers a controller. The name should be the same as in the URL path. For example
 // if the URL is "users/1", the name should be "users". The controller itself can be
 // any struct that implements HTTP method handlers. See README.md and the demo for more
-// details on the structure of a controller.
+// details on the structure of a controller. If the controller implements
+// PolicyProvider, its policies are enforced before running the actions. If it
+// implements HealthCheckProvider, its checks are added to the health endpoints.
 func (this *Application) RegisterController(name string, controller interface{}) {
 	this.controllers[name] = controller
+	this.registerPolicies(name, controller)
+	this.registerHealthChecks(controller)
 }
 
 // Add a route to the application.
@@ -237,6 +636,81 @@ func makeMethodName(requestMethod string, actionName string) string {
 	return strings.Title(strings.ToLower(requestMethod)) + strings.Title(actionName)
 }
 
+// The reverse of makeMethodName(). Splits a controller method name such as
+// "GetFriends" into the request method ("GET") and the action name ("friends").
+// Returns false if the name does not start with a capitalized word.
+func parseMethodName(name string) (string, string, bool) {
+	if len(name) < 2 || name[0] < 'A' || name[0] > 'Z' {
+		return "", "", false
+	}
+	i := 1
+	for ; i < len(name); i++ {
+		if name[i] < 'a' || name[i] > 'z' {
+			break
+		}
+	}
+	if i == 1 {
+		return "", "", false
+	}
+	actionName := name[i:]
+	if actionName != "" {
+		if actionName[0] < 'A' || actionName[0] > 'Z' {
+			return "", "", false
+		}
+		actionName = strings.ToLower(actionName[0:1]) + actionName[1:]
+	}
+	return strings.ToUpper(name[0:i]), actionName, true
+}
+
+var contextPtrType = reflect.TypeOf((*Context)(nil))
+
+// Tells whether the method of a controller is an action, that is if it has a
+// name such as "Get" or "PostFriends" and takes a *Context as only parameter.
+func isActionMethod(method reflect.Method) bool {
+	if method.Type.NumIn() != 2 || method.Type.NumOut() != 0 || method.Type.In(1) != contextPtrType {
+		return false
+	}
+	_, _, ok := parseMethodName(method.Name)
+	return ok
+}
+
+// Returns the request methods handled by at least one of the registered controllers.
+func (this *Application) requestMethods() []string {
+	var output []string
+	found := make(map[string]bool)
+	for _, controller := range this.controllers {
+		t := reflect.TypeOf(controller)
+		for i := 0; i < t.NumMethod(); i++ {
+			method := t.Method(i)
+			if !isActionMethod(method) {
+				continue
+			}
+			requestMethod, _, _ := parseMethodName(method.Name)
+			if !found[requestMethod] {
+				found[requestMethod] = true
+				output = append(output, requestMethod)
+			}
+		}
+	}
+	sort.Strings(output)
+	return output
+}
+
+// Returns the request methods (GET, POST, etc.) for which a controller action
+// exists at the URL of the given request. The method of the request itself is
+// ignored.
+func (this *Application) AllowedMethods(request *http.Request) []string {
+	var output []string
+	for _, requestMethod := range this.requestMethods() {
+		r := *request
+		r.Method = requestMethod
+		if this.matchRequest(&r).Success {
+			output = append(output, requestMethod)
+		}
+	}
+	return output
+}
+
 // Provided for debugging/testing purposes only.
 type MatchRequestResult struct {
 	Success          bool
@@ -246,16 +720,23 @@ type MatchRequestResult struct {
 	ControllerMethod reflect.Value
 	MatchedRoute     Route
 	Params           map[string]string
+	// The access policy of the action, or nil if there is none.
+	Policy *Policy
+	// If not empty, the request only matches a route once its trailing slash
+	// is removed, and the client is redirected to this URL. Success is then
+	// false. See Application.SetTrailingSlashRedirect().
+	RedirectUrl string
 }
 
 func (this *Application) matchRequest(request *http.Request) MatchRequestResult {
 	var output MatchRequestResult
 	output.Success = false
 		
-	path := request.URL.Path
-	path = path[len(this.parsedBaseUrl.Path):len(path)]
-	pathTokens := splitPath(path)
-	
+	pathTokens, redirectUrl, ok := this.requestPathTokens(request.URL)
+	if !ok {
+		return output
+	}
+
 	for routeIndex := 0; routeIndex < len(this.routes); routeIndex++ {
 		route := this.routes[routeIndex]
 		patternTokens := splitPath(route.Pattern)
@@ -278,7 +759,7 @@ func (this *Application) matchRequest(request *http.Request) MatchRequestResult
 				controllerName = pathToken
 			} else if patternToken == ":_action" {
 				actionName = pathToken
-			} else if patternToken == pathToken {
+			} else if patternToken == pathToken || (this.caseInsensitive && strings.EqualFold(patternToken, pathToken)) {
 
 			} else if patternToken[0] == ':' {
 				params[patternToken[1:]] = pathToken
@@ -300,18 +781,17 @@ func (this *Application) matchRequest(request *http.Request) MatchRequestResult
 			actionName = route.Action
 		}
 
-		controller, exists = this.controllers[controllerName]
+		controllerName, controller, exists = this.findController(controllerName)
 		if !exists {
 			continue
 		}
 
-		methodName := makeMethodName(request.Method, actionName)
 		controllerVal := reflect.ValueOf(controller)
-
-		controllerMethod := controllerVal.MethodByName(methodName)
-		if !controllerMethod.IsValid() {
+		methodName, actionName, exists := this.findActionMethod(controllerVal, request.Method, actionName)
+		if !exists {
 			continue
 		}
+		controllerMethod := controllerVal.MethodByName(methodName)
 
 		output.Success = true
 		output.ControllerName = controllerName
@@ -320,26 +800,119 @@ func (this *Application) matchRequest(request *http.Request) MatchRequestResult
 		output.ControllerMethod = controllerMethod
 		output.MatchedRoute = route
 		output.Params = params
+		output.Policy = this.actionPolicy(controllerName, methodName)
+	}
+
+	if output.Success && redirectUrl != "" {
+		output = MatchRequestResult{RedirectUrl: redirectUrl}
 	}
 
 	return output
 }
 
-// Provided for debugging/testing purposes only.
+// Provided for debugging/testing purposes only. The returned context is
+// never nil: if no route matches the request, it holds a 404 error response.
+// Note that older versions returned nil in that case, so callers that check
+// for nil should check for ctx.Response.Status == http.StatusNotFound
+// instead.
 func (this *Application) Dispatch(request *http.Request) *Context {
-	r := this.matchRequest(request)
+	ctx := this.newRequestContext(request)
+	ctx.match = this.matchRequest(request)
+	if ctx.match.Success {
+		ctx.Params = ctx.match.Params
+		ctx.Response.Status = defaultHttpStatus(request.Method)
+	}
+	this.runMiddlewares(ctx, this.matchMiddlewares(ctx.match), 0)
+	return ctx
+}
+
+// Runs the middlewares starting at the given index, and then the action.
+func (this *Application) runMiddlewares(ctx *Context, middlewares []Middleware, index int) {
+	if index >= len(middlewares) {
+		this.runAction(ctx)
+		return
+	}
+	middlewares[index](ctx, func() {
+		this.runMiddlewares(ctx, middlewares, index+1)
+	})
+}
+
+func (this *Application) runAction(ctx *Context) {
+	r := ctx.match
+	if !r.Success && r.RedirectUrl != "" {
+		ctx.Response.Status = this.trailingSlashRedirect
+		ctx.Response.Header.Set("Location", r.RedirectUrl)
+		return
+	}
+
 	if !r.Success {
-		log.Printf("No match for: %s %s\n", request.Method, request.URL)
-		return nil
+		log.Printf("[%s] No match for: %s %s\n", ctx.requestId, ctx.Request.Method, ctx.Request.URL)
+		ctx.Error(http.StatusNotFound, "")
+		return
 	}
 
-	ctx := NewContext()
-	ctx.Request = request
-	ctx.Params = r.Params
-	ctx.Response.Status = defaultHttpStatus(request.Method)
+	if r.Policy != nil && !this.authorize(ctx, r.Policy) {
+		return
+	}
+
+	if !this.checkPreconditions(ctx, r.ControllerValue.Interface()) {
+		return
+	}
+
+	timeout := r.MatchedRoute.Timeout
+	if timeout <= 0 {
+		timeout = this.timeout
+	}
+	if timeout <= 0 {
+		callAction(ctx, r.ControllerMethod)
+		return
+	}
+
+	stdContext, cancel := context.WithTimeout(ctx.stdContext, timeout)
+	defer cancel()
+
+	// The action runs in its own goroutine so that a response can be sent
+	// as soon as the timeout is exceeded. Since the action may still be
+	// running at that point, it is given its own copy of the context and
+	// response. A panic is forwarded to the current goroutine so that it
+	// is handled like any other panic in a handler.
+	actionCtx := *ctx
+	actionCtx.stdContext = stdContext
+	actionCtx.Response = ctx.Response.clone()
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		callAction(&actionCtx, r.ControllerMethod)
+	}()
+
+	select {
+	case p := <-done:
+		if p != nil {
+			panic(p)
+		}
+		ctx.Response = actionCtx.Response
+	case <-stdContext.Done():
+		log.Printf("[%s] Action did not complete: %s %s: %s\n", ctx.requestId, ctx.Request.Method, ctx.Request.URL, stdContext.Err())
+		ctx.stdContext = stdContext
+		ctx.Error(http.StatusServiceUnavailable, "")
+	}
+}
+
+// Builds the context used to dispatch the given request.
+func (this *Application) newRequestContext(request *http.Request) *Context {
+	output := NewContext()
+	output.Request = request
+	output.requestId = this.requestId(request)
+	output.stdContext = request.Context()
+	output.app = this
+	output.Response.Header.Set(this.requestIdHeader, output.requestId)
+	return output
+}
+
+func callAction(ctx *Context, method reflect.Value) {
 	var args []reflect.Value
 	args = append(args, reflect.ValueOf(ctx))
-
-	r.ControllerMethod.Call(args)
-	return ctx
+	method.Call(args)
 }
@@ -1,10 +1,13 @@
 package ripple
 
 import (
+	"context"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestSplitPath(t *testing.T) {
@@ -311,4 +314,181 @@ func TestBaseUrl(t *testing.T) {
 			t.Errorf("Expected %s, got %s", d.action, result.ActionName)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestRequestID(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("testers", &ControllerTesters{})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+
+	var reader io.Reader
+	request, _ := http.NewRequest("GET", "/testers/123", reader)
+	request.Header.Set("X-Request-ID", "abcd-1234")
+	ctx := app.Dispatch(request)
+	if ctx.RequestID() != "abcd-1234" {
+		t.Errorf("Expected %s, got %s", "abcd-1234", ctx.RequestID())
+	}
+	if ctx.Response.Header.Get("X-Request-ID") != "abcd-1234" {
+		t.Errorf("Request ID not echoed in response header: %s", ctx.Response.Header.Get("X-Request-ID"))
+	}
+
+	for _, id := range []string{"", "has space", strings.Repeat("a", 129)} {
+		request, _ = http.NewRequest("GET", "/testers/123", reader)
+		request.Header.Set("X-Request-ID", id)
+		ctx = app.Dispatch(request)
+		if len(ctx.RequestID()) != 32 || ctx.RequestID() == id {
+			t.Errorf("Expected generated request ID, got '%s'", ctx.RequestID())
+		}
+	}
+
+	app.SetRequestIDHeader("X-Trace")
+	request, _ = http.NewRequest("GET", "/nothere", reader)
+	request.Header.Set("X-Trace", "trace-1")
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+	if recorder.Header().Get("X-Trace") != "trace-1" {
+		t.Errorf("Expected %s, got %s", "trace-1", recorder.Header().Get("X-Trace"))
+	}
+	expected := "{\"Error\":\"Not Found\",\"RequestID\":\"trace-1\"}"
+	if recorder.Body.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, recorder.Body.String())
+	}
+}
+
+type contextTestKey struct{}
+
+type ControllerTesters5 struct {
+	Value interface{}
+}
+
+func (this *ControllerTesters5) Get(ctx *Context) {
+	this.Value = ctx.Value(contextTestKey{})
+}
+
+func (this *ControllerTesters5) GetSlow(ctx *Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+	ctx.Response.Body = "done"
+}
+
+func TestContextValues(t *testing.T) {
+	ctx := NewContext()
+	if ctx.Value(contextTestKey{}) != nil {
+		t.Errorf("Expected nil value")
+	}
+	ctx.Set(contextTestKey{}, "tenant")
+	if ctx.Value(contextTestKey{}) != "tenant" {
+		t.Errorf("Expected %s, got %s", "tenant", ctx.Value(contextTestKey{}))
+	}
+
+	var controller ControllerTesters5
+	app := NewApplication()
+	app.RegisterController("testers", &controller)
+	app.AddRoute(Route{Pattern: ":_controller"})
+	var reader io.Reader
+	request, _ := http.NewRequest("GET", "/testers", reader)
+	request = request.WithContext(context.WithValue(request.Context(), contextTestKey{}, "parent"))
+	app.Dispatch(request)
+	if controller.Value != "parent" {
+		t.Errorf("Context not derived from request context. Got %s", controller.Value)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("testers", &ControllerTesters5{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/slow", Action: "slow", Timeout: 10 * time.Millisecond})
+
+	var reader io.Reader
+	request, _ := http.NewRequest("GET", "/testers/slow", reader)
+	ctx := app.Dispatch(request)
+	if ctx.Response.Status != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d, got %d", http.StatusServiceUnavailable, ctx.Response.Status)
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("Expected %s, got %s", context.DeadlineExceeded, ctx.Err())
+	}
+
+	app.SetTimeout(time.Second * 5)
+	request, _ = http.NewRequest("GET", "/testers", reader)
+	ctx = app.Dispatch(request)
+	if ctx.Response.Status != http.StatusOK || ctx.Response.Body != nil {
+		t.Errorf("Expected %d, got %d", http.StatusOK, ctx.Response.Status)
+	}
+}
+
+func TestParseMethodName(t *testing.T) {
+	type ParseMethodNameTest struct {
+		name    string
+		method  string
+		action  string
+		success bool
+	}
+	var parseMethodNameTests = []ParseMethodNameTest{
+		{"Get", "GET", "", true},
+		{"GetFriends", "GET", "friends", true},
+		{"DeleteImage", "DELETE", "image", true},
+		{"PostFriendRequests", "POST", "friendRequests", true},
+		{"G", "", "", false},
+		{"GETFriends", "", "", false},
+		{"get", "", "", false},
+	}
+	for _, d := range parseMethodNameTests {
+		method, action, ok := parseMethodName(d.name)
+		if ok != d.success || method != d.method || action != d.action {
+			t.Errorf("%s: Expected %s/%s/%t, got %s/%s/%t", d.name, d.method, d.action, d.success, method, action, ok)
+		}
+		if ok && makeMethodName(method, action) != d.name {
+			t.Errorf("%s: Expected %s, got %s", d.name, d.name, makeMethodName(method, action))
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("testers", &ControllerTesters{})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+
+	var calls []string
+	app.Use(func(ctx *Context, next func()) {
+		calls = append(calls, "first")
+		next()
+		calls = append(calls, "first done")
+	})
+	app.Use(func(ctx *Context, next func()) {
+		calls = append(calls, "second")
+		if ctx.Params["id"] == "forbidden" {
+			ctx.Error(http.StatusForbidden, "")
+			return
+		}
+		next()
+	})
+
+	var reader io.Reader
+	request, _ := http.NewRequest("GET", "/testers/123", reader)
+	ctx := app.Dispatch(request)
+	if strings.Join(calls, ",") != "first,second,first done" {
+		t.Errorf("Unexpected middleware calls: %s", strings.Join(calls, ","))
+	}
+	if ctx.Response.Status != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, ctx.Response.Status)
+	}
+
+	request, _ = http.NewRequest("GET", "/testers/forbidden", reader)
+	ctx = app.Dispatch(request)
+	if ctx.Response.Status != http.StatusForbidden {
+		t.Errorf("Expected %d, got %d", http.StatusForbidden, ctx.Response.Status)
+	}
+
+	request, _ = http.NewRequest("GET", "/nothere", reader)
+	ctx = app.Dispatch(request)
+	if ctx.Response.Status != http.StatusNotFound {
+		t.Errorf("Expected %d, got %d", http.StatusNotFound, ctx.Response.Status)
+	}
+}
@@ -0,0 +1,246 @@
+package rippletest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/laurent22/ripple"
+)
+
+// Sends requests to an application in-process, through its ServeHTTP()
+// method, so that the requests go through the whole pipeline: middlewares,
+// routing, serialization, compression, etc.
+type Client struct {
+	app *ripple.Application
+	// The headers added to every request, unless the request sets them.
+	Header http.Header
+}
+
+// Build a new client for the application.
+func NewClient(app *ripple.Application) *Client {
+	output := new(Client)
+	output.app = app
+	output.Header = http.Header{}
+	return output
+}
+
+// Sends the request and returns the response. Panics if the request cannot
+// be built.
+func (this *Client) Do(builder *RequestBuilder) *Response {
+	request, err := builder.Build()
+	if err != nil {
+		panic(err)
+	}
+	for name, values := range this.Header {
+		if _, ok := request.Header[name]; !ok {
+			request.Header[name] = append([]string(nil), values...)
+		}
+	}
+	recorder := httptest.NewRecorder()
+	this.app.ServeHTTP(recorder, request)
+
+	output := new(Response)
+	output.Request = request
+	output.requestBody = builder.body
+	output.requestIdHeader = this.app.RequestIDHeader()
+	output.Status = recorder.Code
+	output.Header = recorder.Header()
+	output.Body = recorder.Body.Bytes()
+	return output
+}
+
+// Sends a GET request.
+func (this *Client) Get(path string) *Response {
+	return this.Do(Get(path))
+}
+
+// Sends a POST request with the JSON representation of the value as body.
+func (this *Client) PostJSON(path string, value interface{}) *Response {
+	return this.Do(Post(path).JSON(value))
+}
+
+// A response received by a Client.
+type Response struct {
+	Request *http.Request
+	Status  int
+	Header  http.Header
+	Body    []byte
+
+	requestBody     []byte
+	requestIdHeader string
+}
+
+// Decodes the JSON body into the target.
+func (this *Response) JSON(target interface{}) error {
+	return json.Unmarshal(this.Body, target)
+}
+
+// Checks the status code of the response.
+func (this *Response) AssertStatus(t testing.TB, status int) *Response {
+	t.Helper()
+	if this.Status != status {
+		t.Errorf("%s %s: Expected status %d, got %d (body: %s)", this.Request.Method, this.Request.URL, status, this.Status, this.Body)
+	}
+	return this
+}
+
+// Checks the value of a response header.
+func (this *Response) AssertHeader(t testing.TB, name string, value string) *Response {
+	t.Helper()
+	if this.Header.Get(name) != value {
+		t.Errorf("%s %s: Expected header %s to be %q, got %q", this.Request.Method, this.Request.URL, name, value, this.Header.Get(name))
+	}
+	return this
+}
+
+// Checks that the body contains the given string.
+func (this *Response) AssertBodyContains(t testing.TB, s string) *Response {
+	t.Helper()
+	if !bytes.Contains(this.Body, []byte(s)) {
+		t.Errorf("%s %s: Expected body to contain %q, got %s", this.Request.Method, this.Request.URL, s, this.Body)
+	}
+	return this
+}
+
+// Checks that the body is equivalent to the expected JSON, regardless of the
+// formatting and of the order of the object keys. expected can be a JSON
+// string or any value, which is then serialized to JSON.
+func (this *Response) AssertJSON(t testing.TB, expected interface{}) *Response {
+	t.Helper()
+	actualValue, err := decodeJson(this.Body)
+	if err != nil {
+		t.Errorf("%s %s: Expected a JSON body, got %s", this.Request.Method, this.Request.URL, this.Body)
+		return this
+	}
+	expectedValue, err := normalizeJson(expected, true)
+	if err != nil {
+		t.Errorf("Invalid expected JSON: %s", err)
+		return this
+	}
+	if !reflect.DeepEqual(actualValue, expectedValue) {
+		e, _ := json.Marshal(expectedValue)
+		t.Errorf("%s %s: Expected body %s, got %s", this.Request.Method, this.Request.URL, e, this.Body)
+	}
+	return this
+}
+
+// Checks the value at the given path of the JSON body. The path is made of
+// object keys and array indexes separated by dots, such as "Items.0.Name".
+// The expected value is compared to the JSON value once serialized, so 1,
+// int64(1) and 1.0 are all equal to the JSON number 1.
+func (this *Response) AssertJSONPath(t testing.TB, path string, expected interface{}) *Response {
+	t.Helper()
+	doc, err := decodeJson(this.Body)
+	if err != nil {
+		t.Errorf("%s %s: Expected a JSON body, got %s", this.Request.Method, this.Request.URL, this.Body)
+		return this
+	}
+	actualValue, ok := JSONPath(doc, path)
+	if !ok {
+		t.Errorf("%s %s: Expected a value at %s, got none in %s", this.Request.Method, this.Request.URL, path, this.Body)
+		return this
+	}
+	expectedValue, err := normalizeJson(expected, false)
+	if err != nil {
+		t.Errorf("Invalid expected value: %s", err)
+		return this
+	}
+	if !reflect.DeepEqual(actualValue, expectedValue) {
+		a, _ := json.Marshal(actualValue)
+		e, _ := json.Marshal(expectedValue)
+		t.Errorf("%s %s: Expected %s to be %s, got %s", this.Request.Method, this.Request.URL, path, e, a)
+	}
+	return this
+}
+
+// Returns the value at the given dot-separated path of a decoded JSON value.
+func JSONPath(doc interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return doc, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			value, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			doc = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func decodeJson(data []byte) (interface{}, error) {
+	var output interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&output)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return normalizeNumbers(output), nil
+}
+
+// Converts a value to its decoded JSON form. If parseStrings is true, a
+// string is parsed as JSON.
+func normalizeJson(value interface{}, parseStrings bool) (interface{}, error) {
+	if s, ok := value.(string); ok && parseStrings {
+		output, err := decodeJson([]byte(s))
+		if err == nil {
+			return output, nil
+		}
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJson(b)
+}
+
+// A JSON number in canonical form.
+type jsonNumber string
+
+func (this jsonNumber) MarshalJSON() ([]byte, error) {
+	return []byte(this), nil
+}
+
+// Replaces the json.Number values with their canonical form, so that 1 and
+// 1.0 compare equal.
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err == nil {
+			return jsonNumber(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+		return jsonNumber(v.String())
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeNumbers(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,262 @@
+package rippletest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Set by the RIPPLETEST_UPDATE environment variable. An environment variable
+// is used rather than a flag, which would conflict with the flags of the test
+// packages and would be rejected by the packages that do not use rippletest.
+var update = os.Getenv("RIPPLETEST_UPDATE") != ""
+
+// Replaces the matches of a regular expression in the recorded exchanges.
+type Replacer struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// The replacers applied by default. They replace the dates, in RFC 3339 or
+// HTTP format, and the UUIDs.
+var DefaultReplacers = []Replacer{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<date>"},
+	{regexp.MustCompile(`(Mon|Tue|Wed|Thu|Fri|Sat|Sun), \d{2} (Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{4} \d{2}:\d{2}:\d{2} GMT`), "<date>"},
+	{regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), "<uuid>"},
+}
+
+// Records request/response exchanges into golden files, and compares the
+// exchanges to these files on the next runs. Run the tests with the
+// RIPPLETEST_UPDATE environment variable to create or update the files:
+//
+//	RIPPLETEST_UPDATE=1 go test ./...
+//
+// The volatile parts of the exchanges, such as dates, UUIDs, request IDs and
+// ETags, are normalised so that the files do not change from one run to the
+// next.
+type Golden struct {
+	// The directory of the golden files (default to "testdata").
+	Dir string
+	// The response headers that are not recorded (default to Date and
+	// Content-Length).
+	IgnoreHeaders []string
+	// The response headers whose values are replaced by "<name>" (default to
+	// ETag and Last-Modified). The request ID is always replaced, in the
+	// header and in the body.
+	VolatileHeaders []string
+	// The JSON object keys, at any depth, whose values are replaced by
+	// "<ignored>", for example "Id" or "CreatedAt".
+	IgnoreFields []string
+	// Applied to the whole exchange, after the other normalisations (default
+	// to DefaultReplacers).
+	Replacers []Replacer
+}
+
+// Build a new golden file recorder with the default settings.
+func NewGolden() *Golden {
+	output := new(Golden)
+	output.Dir = "testdata"
+	output.IgnoreHeaders = []string{"Date", "Content-Length"}
+	output.VolatileHeaders = []string{"ETag", "Last-Modified"}
+	output.Replacers = append([]Replacer(nil), DefaultReplacers...)
+	return output
+}
+
+// Compares the exchange to the golden file "<Dir>/<name>.golden", or writes
+// the file if the tests run with RIPPLETEST_UPDATE=1. The name can contain
+// slashes to organise the files in sub-directories.
+func (this *Golden) Assert(t testing.TB, name string, response *Response) *Response {
+	t.Helper()
+	path := filepath.Join(this.Dir, filepath.FromSlash(name)+".golden")
+	actual := this.Render(response)
+
+	if update {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(actual), 0644)
+		}
+		if err != nil {
+			t.Errorf("Cannot write golden file: %s", err)
+		}
+		return response
+	}
+
+	expected, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Errorf("Golden file %s does not exist, run the tests with RIPPLETEST_UPDATE=1 to create it", path)
+		return response
+	}
+	if err != nil {
+		t.Errorf("Cannot read golden file: %s", err)
+		return response
+	}
+	if string(expected) != actual {
+		t.Errorf("%s %s: Response does not match golden file %s (run the tests with RIPPLETEST_UPDATE=1 to accept the changes):\n%s", response.Request.Method, response.Request.URL, path, lineDiff(string(expected), actual))
+	}
+	return response
+}
+
+// Returns the normalised text of the exchange, as it is recorded in the
+// golden files.
+func (this *Golden) Render(response *Response) string {
+	var b strings.Builder
+	request := response.Request
+	b.WriteString(request.Method + " " + request.URL.RequestURI() + "\n")
+	this.writeHeaders(&b, request.Header, "")
+	b.WriteString("\n")
+	if len(response.requestBody) > 0 {
+		b.WriteString(this.renderBody(response.requestBody) + "\n\n")
+	}
+
+	b.WriteString(fmt.Sprintf("HTTP %d %s\n", response.Status, http.StatusText(response.Status)))
+	this.writeHeaders(&b, response.Header, response.requestIdHeader)
+	b.WriteString("\n")
+	if len(response.Body) > 0 {
+		body := this.renderBody(response.Body)
+		// The error bodies include the request ID, which changes on every run.
+		if requestId := response.Header.Get(response.requestIdHeader); response.requestIdHeader != "" && requestId != "" {
+			body = strings.ReplaceAll(body, requestId, "<"+strings.ToLower(http.CanonicalHeaderKey(response.requestIdHeader))+">")
+		}
+		b.WriteString(body + "\n")
+	}
+
+	output := b.String()
+	for _, replacer := range this.Replacers {
+		output = replacer.Pattern.ReplaceAllString(output, replacer.Replacement)
+	}
+	return output
+}
+
+func (this *Golden) writeHeaders(b *strings.Builder, header http.Header, requestIdHeader string) {
+	var names []string
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if containsHeader(this.IgnoreHeaders, name) {
+			continue
+		}
+		for _, value := range header[name] {
+			if containsHeader(this.VolatileHeaders, name) || (requestIdHeader != "" && http.CanonicalHeaderKey(requestIdHeader) == name) {
+				value = "<" + strings.ToLower(name) + ">"
+			}
+			b.WriteString(name + ": " + value + "\n")
+		}
+	}
+}
+
+// Indents the JSON bodies, with the object keys sorted, so that the files are
+// readable and stable. Other bodies are recorded as they are.
+func (this *Golden) renderBody(body []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if decoder.Decode(&value) != nil || decoder.More() {
+		return strings.TrimRight(string(body), "\n")
+	}
+	value = this.ignoreFields(value)
+
+	var output bytes.Buffer
+	encoder := json.NewEncoder(&output)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if encoder.Encode(value) != nil {
+		return strings.TrimRight(string(body), "\n")
+	}
+	return strings.TrimRight(output.String(), "\n")
+}
+
+func (this *Golden) ignoreFields(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if containsString(this.IgnoreFields, key) {
+				v[key] = "<ignored>"
+			} else {
+				v[key] = this.ignoreFields(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = this.ignoreFields(item)
+		}
+	}
+	return value
+}
+
+// Compares the exchange to a golden file using the default settings. See
+// Golden for more information.
+func (this *Response) AssertGolden(t testing.TB, name string) *Response {
+	t.Helper()
+	return NewGolden().Assert(t, name, this)
+}
+
+func containsHeader(names []string, name string) bool {
+	for _, n := range names {
+		if http.CanonicalHeaderKey(n) == http.CanonicalHeaderKey(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a line by line diff of the two texts, where the removed lines start
+// with "-" and the added lines with "+".
+func lineDiff(a string, b string) string {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+
+	// lengths[i][j] is the length of the longest common subsequence of
+	// aLines[i:] and bLines[j:].
+	lengths := make([][]int, len(aLines)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	var output strings.Builder
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			output.WriteString("  " + aLines[i] + "\n")
+			i++
+			j++
+		case i < len(aLines) && (j == len(bLines) || lengths[i+1][j] >= lengths[i][j+1]):
+			output.WriteString("- " + aLines[i] + "\n")
+			i++
+		default:
+			output.WriteString("+ " + bLines[j] + "\n")
+			j++
+		}
+	}
+	return output.String()
+}
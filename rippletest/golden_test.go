@@ -0,0 +1,151 @@
+package rippletest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/laurent22/ripple"
+)
+
+type testEventController struct {
+	title string
+}
+
+// Incremented on each request, so that every response has a different
+// date and sequence number.
+var testEventSequence int64
+
+func (this *testEventController) Get(ctx *ripple.Context) {
+	sequence := atomic.AddInt64(&testEventSequence, 1)
+	ctx.Response.Header.Set("ETag", `"abc123"`)
+	ctx.Response.Header.Set("X-Total", "1")
+	ctx.Response.Body = map[string]interface{}{
+		"Id":        "0f8fad5b-d9cb-469f-a165-70867728950e",
+		"Title":     this.title,
+		"CreatedAt": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(sequence) * time.Second),
+		"Sequence":  sequence,
+	}
+}
+
+func (this *testEventController) Post(ctx *ripple.Context) {
+	ctx.Response.Body = "created"
+}
+
+func newGoldenTestClient(title string) *Client {
+	app := ripple.NewApplication()
+	app.RegisterController("events", &testEventController{title})
+	app.AddRoute(ripple.Route{Pattern: ":_controller/:id"})
+	app.AddRoute(ripple.Route{Pattern: ":_controller"})
+	return NewClient(app)
+}
+
+func TestGoldenRender(t *testing.T) {
+	golden := NewGolden()
+	golden.IgnoreFields = []string{"Sequence"}
+
+	response := newGoldenTestClient("Meeting").Do(Get("/events/1").Query("lang", "fr").Header("Accept", "application/json"))
+	expected := strings.Join([]string{
+		"GET /events/1?lang=fr",
+		"Accept: application/json",
+		"",
+		"HTTP 200 OK",
+		"Content-Type: application/json",
+		"Etag: <etag>",
+		"X-Request-Id: <x-request-id>",
+		"X-Total: 1",
+		"",
+		"{",
+		"  \"CreatedAt\": \"<date>\",",
+		"  \"Id\": \"<uuid>\",",
+		"  \"Sequence\": \"<ignored>\",",
+		"  \"Title\": \"Meeting\"",
+		"}",
+		"",
+	}, "\n")
+	if actual := golden.Render(response); actual != expected {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+
+	response = newGoldenTestClient("Meeting").Do(Post("/events").Body("<event/>"))
+	expected = strings.Join([]string{
+		"POST /events",
+		"",
+		"<event/>",
+		"",
+		"HTTP 201 Created",
+		"Content-Type: application/json",
+		"X-Request-Id: <x-request-id>",
+		"",
+		"created",
+		"",
+	}, "\n")
+	if actual := golden.Render(response); actual != expected {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
+
+func TestGoldenRenderError(t *testing.T) {
+	golden := NewGolden()
+	first := golden.Render(newGoldenTestClient("Meeting").Get("/nothere"))
+	second := golden.Render(newGoldenTestClient("Meeting").Get("/nothere"))
+	if first != second {
+		t.Errorf("Expected %s, got %s", first, second)
+	}
+	if !strings.Contains(first, "\"RequestID\": \"<x-request-id>\"") {
+		t.Errorf("Expected the request ID to be normalised, got %s", first)
+	}
+}
+
+func TestGoldenAssert(t *testing.T) {
+	golden := NewGolden()
+	golden.Dir = t.TempDir()
+	golden.IgnoreFields = []string{"Sequence"}
+	path := filepath.Join(golden.Dir, "events", "get.golden")
+
+	recorder := &recorderT{TB: t}
+	golden.Assert(recorder, "events/get", newGoldenTestClient("Meeting").Get("/events/1"))
+	if len(recorder.errors) != 1 || !strings.Contains(recorder.errors[0], "run the tests with RIPPLETEST_UPDATE=1") {
+		t.Errorf("Expected a missing file error, got %v", recorder.errors)
+	}
+
+	update = true
+	golden.Assert(t, "events/get", newGoldenTestClient("Meeting").Get("/events/1"))
+	update = false
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected golden file to be written, got %s", err)
+	}
+
+	// The dates and sequence numbers differ, but they are normalised.
+	golden.Assert(t, "events/get", newGoldenTestClient("Meeting").Get("/events/1"))
+
+	recorder = &recorderT{TB: t}
+	golden.Assert(recorder, "events/get", newGoldenTestClient("Party").Get("/events/1"))
+	if len(recorder.errors) != 1 || !strings.Contains(recorder.errors[0], "-   \"Title\": \"Meeting\"\n+   \"Title\": \"Party\"") {
+		t.Errorf("Expected a diff of the titles, got %v", recorder.errors)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	type testCase struct {
+		a        string
+		b        string
+		expected string
+	}
+
+	testCases := []testCase{
+		{"a\nb\nc", "a\nb\nc", "  a\n  b\n  c\n"},
+		{"a\nb\nc", "a\nc", "  a\n- b\n  c\n"},
+		{"a\nc", "a\nb\nc", "  a\n+ b\n  c\n"},
+		{"a\nb", "a\nc", "  a\n- b\n+ c\n"},
+	}
+
+	for _, d := range testCases {
+		if actual := lineDiff(d.a, d.b); actual != d.expected {
+			t.Errorf("Expected %q, got %q", d.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Package rippletest provides utilities to test Ripple applications and
+// controllers: a request builder, a client that sends the requests through
+// the whole application, including the middlewares, and assertions on the
+// responses.
+//
+//	func TestGetUser(t *testing.T) {
+//		client := rippletest.NewClient(newApplication())
+//		client.Do(rippletest.Get("/users/1")).
+//			AssertStatus(t, http.StatusOK).
+//			AssertJSONPath(t, "Name", "John")
+//	}
+package rippletest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/laurent22/ripple"
+)
+
+// Builds an HTTP request step by step. Use NewRequest() or one of the
+// shortcuts, such as Get() or Post(), to create it.
+type RequestBuilder struct {
+	method  string
+	path    string
+	query   url.Values
+	header  http.Header
+	body    []byte
+	params  map[string]string
+	context context.Context
+	err     error
+}
+
+// Build a new request builder.
+func NewRequest(method string, path string) *RequestBuilder {
+	output := new(RequestBuilder)
+	output.method = method
+	output.path = path
+	output.query = url.Values{}
+	output.header = http.Header{}
+	output.params = make(map[string]string)
+	return output
+}
+
+// Build a new GET request builder.
+func Get(path string) *RequestBuilder {
+	return NewRequest("GET", path)
+}
+
+// Build a new POST request builder.
+func Post(path string) *RequestBuilder {
+	return NewRequest("POST", path)
+}
+
+// Build a new PUT request builder.
+func Put(path string) *RequestBuilder {
+	return NewRequest("PUT", path)
+}
+
+// Build a new PATCH request builder.
+func Patch(path string) *RequestBuilder {
+	return NewRequest("PATCH", path)
+}
+
+// Build a new DELETE request builder.
+func Delete(path string) *RequestBuilder {
+	return NewRequest("DELETE", path)
+}
+
+// Adds a query parameter.
+func (this *RequestBuilder) Query(name string, value string) *RequestBuilder {
+	this.query.Add(name, value)
+	return this
+}
+
+// Sets a header.
+func (this *RequestBuilder) Header(name string, value string) *RequestBuilder {
+	this.header.Set(name, value)
+	return this
+}
+
+// Sets the Authorization header to a bearer token.
+func (this *RequestBuilder) Bearer(token string) *RequestBuilder {
+	return this.Header("Authorization", "Bearer "+token)
+}
+
+// Sets the Authorization header to the given basic credentials.
+func (this *RequestBuilder) BasicAuth(username string, password string) *RequestBuilder {
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.SetBasicAuth(username, password)
+	return this.Header("Authorization", request.Header.Get("Authorization"))
+}
+
+// Sets the raw request body.
+func (this *RequestBuilder) Body(body string) *RequestBuilder {
+	this.body = []byte(body)
+	return this
+}
+
+// Sets the request body to the JSON representation of the value, and the
+// Content-Type header to "application/json" unless it is already set.
+func (this *RequestBuilder) JSON(value interface{}) *RequestBuilder {
+	b, err := json.Marshal(value)
+	if err != nil {
+		this.err = err
+		return this
+	}
+	this.body = b
+	if this.header.Get("Content-Type") == "" {
+		this.header.Set("Content-Type", "application/json")
+	}
+	return this
+}
+
+// Sets a route parameter. The parameters are only used by NewContext(),
+// since requests sent by a Client get them from the route.
+func (this *RequestBuilder) Param(name string, value string) *RequestBuilder {
+	this.params[name] = value
+	return this
+}
+
+// Sets the context of the request, for example to test cancellation. It is
+// not used by NewContext(), whose context is never cancelled.
+func (this *RequestBuilder) WithContext(ctx context.Context) *RequestBuilder {
+	this.context = ctx
+	return this
+}
+
+// Builds the request. Returns an error if the path is not valid or if the
+// JSON body could not be serialized.
+func (this *RequestBuilder) Build() (*http.Request, error) {
+	if this.err != nil {
+		return nil, this.err
+	}
+	u, err := url.Parse(this.path)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	for name, values := range this.query {
+		query[name] = append(query[name], values...)
+	}
+	u.RawQuery = query.Encode()
+
+	var body io.Reader
+	if this.body != nil {
+		body = bytes.NewReader(this.body)
+	}
+	output := httptest.NewRequest(this.method, u.String(), body)
+	for name, values := range this.header {
+		output.Header[name] = append([]string(nil), values...)
+	}
+	if this.context != nil {
+		output = output.WithContext(this.context)
+	}
+	return output, nil
+}
+
+// Builds a context to call a controller action directly, without going
+// through the application. As with Application.Dispatch(), the response
+// status defaults to 201 for POST requests and 200 otherwise. Panics if the
+// request cannot be built.
+//
+//	ctx := rippletest.NewContext(rippletest.Get("/users/1").Param("id", "1"))
+//	controller.Get(ctx)
+//	if ctx.Response.Status != http.StatusOK {
+//		...
+//	}
+func NewContext(builder *RequestBuilder) *ripple.Context {
+	request, err := builder.Build()
+	if err != nil {
+		panic(err)
+	}
+	output := ripple.NewContext()
+	output.Request = request
+	output.Response.Status = http.StatusOK
+	if request.Method == "POST" {
+		output.Response.Status = http.StatusCreated
+	}
+	for name, value := range builder.params {
+		output.Params[name] = value
+	}
+	return output
+}
@@ -0,0 +1,142 @@
+package rippletest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/laurent22/ripple"
+)
+
+type testUser struct {
+	Id   int
+	Name string
+}
+
+type testUserController struct{}
+
+func (this *testUserController) Get(ctx *ripple.Context) {
+	if ctx.Params["id"] != "1" {
+		ctx.Error(http.StatusNotFound, "")
+		return
+	}
+	ctx.Response.Header.Set("X-Sort", ctx.Request.URL.Query().Get("sort"))
+	ctx.Response.Body = testUser{1, "John"}
+}
+
+func (this *testUserController) Post(ctx *ripple.Context) {
+	body, _ := io.ReadAll(ctx.Request.Body)
+	ctx.Response.Body = map[string]interface{}{
+		"body":          string(body),
+		"contentType":   ctx.Request.Header.Get("Content-Type"),
+		"authorization": ctx.Request.Header.Get("Authorization"),
+	}
+}
+
+func newTestApplication() *ripple.Application {
+	app := ripple.NewApplication()
+	app.RegisterController("users", &testUserController{})
+	app.AddRoute(ripple.Route{Pattern: ":_controller"})
+	app.AddRoute(ripple.Route{Pattern: ":_controller/:id"})
+	app.Use(func(ctx *ripple.Context, next func()) {
+		ctx.Response.Header.Set("X-Middleware", "yes")
+		next()
+	})
+	return app
+}
+
+// Records the errors instead of failing the test, to check the assertions.
+type recorderT struct {
+	testing.TB
+	errors []string
+}
+
+func (this *recorderT) Helper() {}
+
+func (this *recorderT) Errorf(format string, args ...interface{}) {
+	this.errors = append(this.errors, fmt.Sprintf(format, args...))
+}
+
+func TestClient(t *testing.T) {
+	client := NewClient(newTestApplication())
+	client.Header.Set("Authorization", "Bearer default")
+
+	client.Do(Get("/users/1").Query("sort", "-name")).
+		AssertStatus(t, http.StatusOK).
+		AssertHeader(t, "X-Middleware", "yes").
+		AssertHeader(t, "X-Sort", "-name").
+		AssertHeader(t, "Content-Type", "application/json").
+		AssertJSON(t, `{"Name": "John", "Id": 1}`).
+		AssertJSON(t, testUser{1, "John"}).
+		AssertJSONPath(t, "Id", 1.0).
+		AssertJSONPath(t, "Name", "John").
+		AssertBodyContains(t, "John")
+
+	client.Get("/users/2").
+		AssertStatus(t, http.StatusNotFound).
+		AssertJSONPath(t, "Error", "Not Found")
+
+	client.PostJSON("/users", map[string]string{"Name": "Jane"}).
+		AssertStatus(t, http.StatusCreated).
+		AssertJSONPath(t, "body", `{"Name":"Jane"}`).
+		AssertJSONPath(t, "contentType", "application/json").
+		AssertJSONPath(t, "authorization", "Bearer default")
+
+	client.Do(Post("/users").Body("raw").BasicAuth("john", "secret")).
+		AssertJSONPath(t, "body", "raw").
+		AssertJSONPath(t, "authorization", "Basic am9objpzZWNyZXQ=")
+
+	var user testUser
+	err := client.Get("/users/1").JSON(&user)
+	if err != nil || user.Name != "John" {
+		t.Errorf("Expected %s, got %s (%v)", "John", user.Name, err)
+	}
+}
+
+func TestAssertionFailures(t *testing.T) {
+	client := NewClient(newTestApplication())
+	response := client.Get("/users/1")
+
+	type testCase struct {
+		assert   func(t testing.TB)
+		expected string
+	}
+
+	testCases := []testCase{
+		{func(t testing.TB) { response.AssertStatus(t, http.StatusCreated) }, "Expected status 201, got 200"},
+		{func(t testing.TB) { response.AssertHeader(t, "X-Sort", "id") }, "Expected header X-Sort to be \"id\", got \"\""},
+		{func(t testing.TB) { response.AssertJSON(t, `{"Id": 2, "Name": "John"}`) }, "Expected body {\"Id\":2,\"Name\":\"John\"}"},
+		{func(t testing.TB) { response.AssertJSONPath(t, "Id", "1") }, "Expected Id to be \"1\", got 1"},
+		{func(t testing.TB) { response.AssertJSONPath(t, "Email", "") }, "Expected a value at Email"},
+		{func(t testing.TB) { response.AssertBodyContains(t, "Jane") }, "Expected body to contain \"Jane\""},
+	}
+
+	for i, d := range testCases {
+		recorder := &recorderT{TB: t}
+		d.assert(recorder)
+		if len(recorder.errors) != 1 || !strings.Contains(recorder.errors[0], d.expected) {
+			t.Errorf("Test %d: Expected %s, got %v", i, d.expected, recorder.errors)
+		}
+	}
+}
+
+func TestNewContext(t *testing.T) {
+	ctx := NewContext(Get("/users/1").Param("id", "1").Header("Accept-Language", "fr"))
+	(&testUserController{}).Get(ctx)
+	if ctx.Response.Status != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, ctx.Response.Status)
+	}
+	if ctx.Response.Body.(testUser).Name != "John" {
+		t.Errorf("Expected %s, got %v", "John", ctx.Response.Body)
+	}
+	if ctx.Request.Header.Get("Accept-Language") != "fr" {
+		t.Errorf("Expected %s, got %s", "fr", ctx.Request.Header.Get("Accept-Language"))
+	}
+
+	_, err := Get("/users").JSON(func() {}).Build()
+	if err == nil {
+		t.Errorf("Expected an error for a body that cannot be serialized")
+	}
+}
@@ -0,0 +1,168 @@
+package ripple
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// A controller action reachable through a route, as returned by
+// Application.Routes().
+type RouteEntry struct {
+	// The request method, such as "GET".
+	Method string
+	// The path of the action, relative to the base URL, with the parameters
+	// in the ":name" form. For example, "/users/:id/friends".
+	Path string
+	// The names of the parameters in the path.
+	Params     []string
+	Controller string
+	Action     string
+	// The name of the controller method, such as "GetFriends".
+	MethodName string
+	// The route that leads to the action, and its index in the order in
+	// which the routes have been added.
+	Route      Route
+	RouteIndex int
+	// The access policy of the action, or nil if there is none.
+	Policy *Policy
+}
+
+// The request methods defined by RFC 9110 and RFC 5789. Controller methods
+// such as "HelperFoo" could in theory be reached with a custom "HELPER" method,
+// but they are not listed by Routes().
+var standardMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT"}
+
+// Returns the controller actions reachable through the routes of the
+// application. The ":_controller" and ":_action" tokens of the route patterns
+// are expanded against the registered controllers and their actions. When
+// several routes give the same request method and path, only the one that
+// wins is returned, which is the last one added. The result is sorted by
+// path, then request method.
+func (this *Application) Routes() []RouteEntry {
+	var controllerNames []string
+	for name := range this.controllers {
+		controllerNames = append(controllerNames, name)
+	}
+	sort.Strings(controllerNames)
+
+	indexes := make(map[string]int)
+	var output []RouteEntry
+	for routeIndex, route := range this.routes {
+		for _, controllerName := range controllerNames {
+			for _, entry := range this.expandRoute(route, controllerName) {
+				entry.RouteIndex = routeIndex
+				key := entry.Method + " " + entry.Path
+				if index, ok := indexes[key]; ok {
+					output[index] = entry
+				} else {
+					indexes[key] = len(output)
+					output = append(output, entry)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(output, func(i, j int) bool {
+		if output[i].Path != output[j].Path {
+			return output[i].Path < output[j].Path
+		}
+		return output[i].Method < output[j].Method
+	})
+	return output
+}
+
+// Returns the actions of the controller that the route leads to.
+func (this *Application) expandRoute(route Route, controllerName string) []RouteEntry {
+	patternTokens := splitPath(route.Pattern)
+	hasController := false
+	hasAction := false
+	for _, token := range patternTokens {
+		if token == ":_controller" {
+			hasController = true
+		} else if token == ":_action" {
+			hasAction = true
+		}
+	}
+	if !hasController && controllerName != route.Controller {
+		return nil
+	}
+
+	var output []RouteEntry
+	t := reflect.TypeOf(this.controllers[controllerName])
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		if !isActionMethod(method) {
+			continue
+		}
+		requestMethod, actionName, _ := parseMethodName(method.Name)
+		if !containsString(standardMethods, requestMethod) {
+			continue
+		}
+		if hasAction && actionName == "" {
+			continue
+		}
+		if !hasAction && actionName != route.Action {
+			continue
+		}
+
+		var segments []string
+		var params []string
+		for _, token := range patternTokens {
+			if token == ":_controller" {
+				segments = append(segments, controllerName)
+			} else if token == ":_action" {
+				segments = append(segments, actionName)
+			} else {
+				if token[0] == ':' {
+					params = append(params, token[1:])
+				}
+				segments = append(segments, token)
+			}
+		}
+
+		output = append(output, RouteEntry{
+			Method:     requestMethod,
+			Path:       "/" + strings.Join(segments, "/"),
+			Params:     params,
+			Controller: controllerName,
+			Action:     actionName,
+			MethodName: method.Name,
+			Route:      route,
+			Policy:     this.actionPolicy(controllerName, method.Name),
+		})
+	}
+	return output
+}
+
+// Writes the table of the routes returned by Routes(), with the paths
+// prefixed by the base URL.
+func (this *Application) WriteRoutes(w io.Writer) error {
+	basePath := strings.TrimSuffix(this.parsedBaseUrl.Path, "/")
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "METHOD\tPATH\tCONTROLLER\tACTION\tROUTE\tPOLICY")
+	for _, entry := range this.Routes() {
+		action := entry.Action
+		if action == "" {
+			action = "-"
+		}
+		policy := "-"
+		if entry.Policy != nil {
+			var parts []string
+			if len(entry.Policy.Roles) > 0 {
+				parts = append(parts, "roles="+strings.Join(entry.Policy.Roles, "|"))
+			}
+			if len(entry.Policy.Scopes) > 0 {
+				parts = append(parts, "scopes="+strings.Join(entry.Policy.Scopes, ","))
+			}
+			if len(parts) > 0 {
+				policy = strings.Join(parts, " ")
+			}
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t#%d %s\t%s\n", entry.Method, basePath+entry.Path, entry.Controller, action, entry.RouteIndex, entry.Route.Pattern, policy)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,95 @@
+package ripple
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type ControllerRoutesTester struct{}
+
+func (this *ControllerRoutesTester) Get(ctx *Context)        {}
+func (this *ControllerRoutesTester) Post(ctx *Context)       {}
+func (this *ControllerRoutesTester) GetFriends(ctx *Context) {}
+func (this *ControllerRoutesTester) GetNew(ctx *Context)     {}
+func (this *ControllerRoutesTester) Helper(ctx *Context)     {}
+
+func (this *ControllerRoutesTester) Policies() map[string]Policy {
+	return map[string]Policy{
+		"Post": {Roles: []string{"admin"}, Scopes: []string{"users:write"}},
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	app := NewApplication()
+	app.RegisterController("users", &ControllerRoutesTester{})
+	app.RegisterController("tasks", &ControllerTesters4{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+	app.AddRoute(Route{Pattern: "users/new", Controller: "users", Action: "new"})
+	app.AddRoute(Route{Pattern: ":_controller/:_action"})
+
+	type testCase struct {
+		method     string
+		path       string
+		controller string
+		action     string
+		routeIndex int
+	}
+
+	expected := []testCase{
+		{"GET", "/tasks", "tasks", "", 0},
+		{"GET", "/tasks/:id", "tasks", "", 1},
+		{"GET", "/tasks/:id/other", "tasks", "other", 2},
+		{"GET", "/tasks/other", "tasks", "other", 4},
+		{"GET", "/users", "users", "", 0},
+		{"POST", "/users", "users", "", 0},
+		{"GET", "/users/:id", "users", "", 1},
+		{"POST", "/users/:id", "users", "", 1},
+		{"GET", "/users/:id/friends", "users", "friends", 2},
+		{"GET", "/users/:id/new", "users", "new", 2},
+		{"GET", "/users/friends", "users", "friends", 4},
+		{"GET", "/users/new", "users", "new", 4},
+	}
+
+	routes := app.Routes()
+	if len(routes) != len(expected) {
+		t.Fatalf("Expected %d routes, got %d: %v", len(expected), len(routes), routes)
+	}
+	for i, d := range expected {
+		r := routes[i]
+		if r.Method != d.method || r.Path != d.path || r.Controller != d.controller || r.Action != d.action || r.RouteIndex != d.routeIndex {
+			t.Errorf("Test %d: Expected %v, got %s %s %s %s %d", i, d, r.Method, r.Path, r.Controller, r.Action, r.RouteIndex)
+		}
+	}
+
+	if routes[7].Policy == nil || routes[7].Policy.Roles[0] != "admin" {
+		t.Errorf("Expected admin policy, got %v", routes[7].Policy)
+	}
+	if len(routes[6].Params) != 1 || routes[6].Params[0] != "id" {
+		t.Errorf("Expected [id], got %v", routes[6].Params)
+	}
+}
+
+func TestWriteRoutes(t *testing.T) {
+	app := NewApplication()
+	app.SetBaseUrl("/api/")
+	app.RegisterController("users", &ControllerRoutesTester{})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+
+	var output bytes.Buffer
+	app.WriteRoutes(&output)
+	expected := []string{
+		"METHOD  PATH            CONTROLLER  ACTION  ROUTE                POLICY",
+		"GET     /api/users/:id  users       -       #0 :_controller/:id  -",
+		"POST    /api/users/:id  users       -       #0 :_controller/:id  roles=admin scopes=users:write",
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " ")
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+}
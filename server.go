@@ -0,0 +1,319 @@
+package ripple
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Returned by Serve() and Run() if the application is already served, or has
+// already been served. The listener is then left open.
+var ErrAlreadyServing = errors.New("the application is already being served")
+
+// Controllers that implement StartHook are started by Serve() and Run(),
+// before the server accepts requests, for example to open connections.
+type StartHook interface {
+	OnStart() error
+}
+
+// Controllers that implement ShutdownHook are notified by Serve() and Run()
+// once the server has stopped, so that they can close their resources. The
+// context expires at the end of the shutdown timeout.
+type ShutdownHook interface {
+	OnShutdown(ctx context.Context) error
+}
+
+type lifecycle struct {
+	mutex           sync.Mutex
+	server          *http.Server
+	shutdownTimeout time.Duration
+	shutdownDelay   time.Duration
+	startHooks      []func() error
+	shutdownHooks   []func(ctx context.Context) error
+	stop            chan struct{}
+	stopOnce        sync.Once
+	done            chan struct{}
+	shuttingDown    bool
+	draining        chan struct{}
+}
+
+func newLifecycle() *lifecycle {
+	output := new(lifecycle)
+	output.shutdownTimeout = 30 * time.Second
+	return output
+}
+
+// Returns the HTTP server used by Serve() and Run(). It can be customized
+// before starting the application. By default, its handler is the
+// application, and it has the following timeouts: 10 seconds to read the
+// request headers, 30 seconds to read the whole request, 60 seconds to write
+// the response and 120 seconds for idle keep-alive connections. Streamed
+// responses that last longer need a larger WriteTimeout.
+func (this *Application) Server() *http.Server {
+	this.lifecycle.mutex.Lock()
+	defer this.lifecycle.mutex.Unlock()
+	if this.lifecycle.server == nil {
+		this.lifecycle.server = &http.Server{
+			Handler:           this,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+		}
+	}
+	return this.lifecycle.server
+}
+
+// Sets how long the in-flight requests and shutdown hooks are given to
+// complete when the server stops (default to 30 seconds). After that, the
+// remaining connections are closed.
+func (this *Application) SetShutdownTimeout(v time.Duration) {
+	this.lifecycle.shutdownTimeout = v
+}
+
+// Returns the shutdown timeout.
+func (this *Application) ShutdownTimeout() time.Duration {
+	return this.lifecycle.shutdownTimeout
+}
+
+// Sets how long the server keeps accepting requests once it has been asked to
+// stop (default to 0). During that time, the readiness endpoint fails, so
+// that the load balancers have time to notice it and to stop sending requests
+// to the application before the server closes its listener.
+func (this *Application) SetShutdownDelay(v time.Duration) {
+	this.lifecycle.shutdownDelay = v
+}
+
+// Returns the shutdown delay.
+func (this *Application) ShutdownDelay() time.Duration {
+	return this.lifecycle.shutdownDelay
+}
+
+// Adds a function that runs when the application starts, before the server
+// accepts requests. The functions run in the order in which they have been
+// added, before the OnStart() method of the controllers. If one of them
+// fails, the application does not start.
+func (this *Application) OnStart(hook func() error) {
+	this.lifecycle.startHooks = append(this.lifecycle.startHooks, hook)
+}
+
+// Adds a function that runs when the application stops, once the in-flight
+// requests have completed. The functions run in the reverse order in which
+// they have been added, after the OnShutdown() method of the controllers.
+func (this *Application) OnShutdown(hook func(ctx context.Context) error) {
+	this.lifecycle.shutdownHooks = append(this.lifecycle.shutdownHooks, hook)
+}
+
+// Tells whether the application is shutting down, that is whether it has
+// been asked to stop and is draining the in-flight requests.
+func (this *Application) ShuttingDown() bool {
+	this.lifecycle.mutex.Lock()
+	defer this.lifecycle.mutex.Unlock()
+	return this.lifecycle.shuttingDown
+}
+
+// Listens on the given address and serves the application until it receives
+// SIGINT or SIGTERM, or until Shutdown() is called. The address is either a
+// TCP address, such as ":8080", or a Unix socket path prefixed with "unix:",
+// such as "unix:/run/app.sock". See Serve() for more information.
+func (this *Application) Run(address string) error {
+	network := "tcp"
+	if strings.HasPrefix(address, "unix:") {
+		network = "unix"
+		address = strings.TrimPrefix(address, "unix:")
+		// Removes the socket left over by a previous process that did not
+		// exit cleanly, but not the one of a process that is still running.
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			conn, err := net.Dial("unix", address)
+			if err == nil {
+				conn.Close()
+			} else if errors.Is(err, syscall.ECONNREFUSED) {
+				os.Remove(address)
+			}
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return this.Serve(listener)
+}
+
+// Serves the application on the listener until it receives SIGINT or
+// SIGTERM, or until Shutdown() is called. The start hooks run first, then the
+// server accepts requests. When the server stops, it stops accepting new
+// requests, waits for the in-flight requests to complete, for up to the
+// shutdown timeout, and runs the shutdown hooks. Returns nil if the server
+// has stopped gracefully.
+//
+// If a start hook fails, the server does not start and the error is returned.
+// If other start hooks have succeeded before, the shutdown hooks of the
+// controllers that have started run, followed by those of the application.
+func (this *Application) Serve(listener net.Listener) error {
+	server := this.Server()
+
+	this.lifecycle.mutex.Lock()
+	if this.lifecycle.done != nil {
+		this.lifecycle.mutex.Unlock()
+		return ErrAlreadyServing
+	}
+	this.lifecycle.stop = make(chan struct{})
+	this.lifecycle.done = make(chan struct{})
+	this.lifecycle.draining = make(chan struct{})
+	this.lifecycle.mutex.Unlock()
+	defer close(this.lifecycle.done)
+
+	started, count, err := this.runStartHooks()
+	if err != nil {
+		listener.Close()
+		this.lifecycle.mutex.Lock()
+		this.lifecycle.shuttingDown = true
+		close(this.lifecycle.draining)
+		this.lifecycle.mutex.Unlock()
+		if count > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), this.lifecycle.shutdownTimeout)
+			defer cancel()
+			this.runShutdownHooks(ctx, started)
+		}
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	log.Printf("Listening on %s\n", listener.Addr())
+
+	select {
+	case err = <-serveErr:
+		log.Printf("Server error: %s\n", err)
+	case s := <-signals:
+		log.Printf("Received %s, shutting down\n", s)
+	case <-this.lifecycle.stop:
+		log.Printf("Shutting down\n")
+	}
+
+	this.lifecycle.mutex.Lock()
+	this.lifecycle.shuttingDown = true
+	close(this.lifecycle.draining)
+	this.lifecycle.mutex.Unlock()
+
+	if err == nil && this.lifecycle.shutdownDelay > 0 {
+		log.Printf("Waiting %s before closing the listener\n", this.lifecycle.shutdownDelay)
+		time.Sleep(this.lifecycle.shutdownDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), this.lifecycle.shutdownTimeout)
+	defer cancel()
+	if err == nil {
+		err = server.Shutdown(ctx)
+		if err != nil {
+			log.Printf("Requests did not complete: %s\n", err)
+			server.Close()
+		}
+	}
+	hookErr := this.runShutdownHooks(ctx, this.sortedControllerNames())
+	if err == nil {
+		err = hookErr
+	}
+	return err
+}
+
+// Stops the application started by Serve() or Run() and waits until it has
+// stopped, or until the context expires. Does nothing if the application is
+// not served.
+func (this *Application) Shutdown(ctx context.Context) error {
+	this.lifecycle.mutex.Lock()
+	stop := this.lifecycle.stop
+	done := this.lifecycle.done
+	this.lifecycle.mutex.Unlock()
+	if stop == nil {
+		return nil
+	}
+	this.lifecycle.stopOnce.Do(func() {
+		close(stop)
+	})
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Returns the names of the controllers, sorted so that the hooks always run
+// in the same order.
+func (this *Application) sortedControllerNames() []string {
+	var output []string
+	for name := range this.controllers {
+		output = append(output, name)
+	}
+	sort.Strings(output)
+	return output
+}
+
+// Runs the start hooks until one of them fails. Returns the names of the
+// controllers that have started, so that only those are shut down, and the
+// number of hooks that have succeeded.
+func (this *Application) runStartHooks() ([]string, int, error) {
+	var names []string
+	count := 0
+	for _, hook := range this.lifecycle.startHooks {
+		err := hook()
+		if err != nil {
+			return names, count, err
+		}
+		count++
+	}
+	for _, name := range this.sortedControllerNames() {
+		if hook, ok := this.controllers[name].(StartHook); ok {
+			err := hook.OnStart()
+			if err != nil {
+				return names, count, err
+			}
+			count++
+		}
+		names = append(names, name)
+	}
+	return names, count, nil
+}
+
+// Runs the shutdown hooks of the given controllers and of the application,
+// even if some of them fail, and returns the first error.
+func (this *Application) runShutdownHooks(ctx context.Context, names []string) error {
+	var output error
+	for i := len(names) - 1; i >= 0; i-- {
+		if hook, ok := this.controllers[names[i]].(ShutdownHook); ok {
+			err := hook.OnShutdown(ctx)
+			if err != nil {
+				log.Printf("Shutdown of controller \"%s\" failed: %s\n", names[i], err)
+				if output == nil {
+					output = err
+				}
+			}
+		}
+	}
+	for i := len(this.lifecycle.shutdownHooks) - 1; i >= 0; i-- {
+		err := this.lifecycle.shutdownHooks[i](ctx)
+		if err != nil {
+			log.Printf("Shutdown hook failed: %s\n", err)
+			if output == nil {
+				output = err
+			}
+		}
+	}
+	return output
+}
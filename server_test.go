@@ -0,0 +1,329 @@
+package ripple
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type ControllerServerTester struct {
+	name     string
+	events   *[]string
+	mutex    *sync.Mutex
+	started  chan bool
+	release  chan bool
+	startErr error
+}
+
+func (this *ControllerServerTester) record(event string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	*this.events = append(*this.events, event)
+}
+
+func (this *ControllerServerTester) Get(ctx *Context) {
+	ctx.Response.Body = this.name
+}
+
+func (this *ControllerServerTester) GetSlow(ctx *Context) {
+	this.started <- true
+	<-this.release
+	ctx.Response.Body = "slow"
+}
+
+func (this *ControllerServerTester) OnStart() error {
+	this.record("start " + this.name)
+	return this.startErr
+}
+
+func (this *ControllerServerTester) OnShutdown(ctx context.Context) error {
+	this.record("shutdown " + this.name)
+	return nil
+}
+
+func newServerTestApplication() (*Application, *ControllerServerTester, func() []string) {
+	events := []string{}
+	mutex := &sync.Mutex{}
+	app := NewApplication()
+	first := &ControllerServerTester{"a", &events, mutex, make(chan bool), make(chan bool), nil}
+	app.RegisterController("a", first)
+	app.RegisterController("b", &ControllerServerTester{"b", &events, mutex, nil, nil, nil})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:_action"})
+	app.OnStart(func() error {
+		first.record("start app 1")
+		return nil
+	})
+	app.OnStart(func() error {
+		first.record("start app 2")
+		return nil
+	})
+	app.OnShutdown(func(ctx context.Context) error {
+		first.record("shutdown app 1")
+		return nil
+	})
+	app.OnShutdown(func(ctx context.Context) error {
+		if app.ShuttingDown() {
+			first.record("shutdown app 2")
+		}
+		return errors.New("failed")
+	})
+	return app, first, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), events...)
+	}
+}
+
+func httpGetBody(t *testing.T, client *http.Client, u string) string {
+	response, err := client.Get(u)
+	if err != nil {
+		t.Errorf("Expected no error, got %s", err)
+		return ""
+	}
+	defer response.Body.Close()
+	b, _ := io.ReadAll(response.Body)
+	return string(b)
+}
+
+// Runs the application in the background, and returns once it is listening.
+// The returned channel receives the result of Run().
+func runListening(t *testing.T, app *Application, address string) chan error {
+	listening := make(chan bool)
+	app.OnStart(func() error {
+		close(listening)
+		return nil
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Run(address)
+	}()
+	select {
+	case <-listening:
+	case err := <-served:
+		t.Fatalf("Expected the application to start, got %v", err)
+	}
+	return served
+}
+
+func TestServe(t *testing.T) {
+	app, controller, events := newServerTestApplication()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := "http://" + listener.Addr().String()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Serve(listener)
+	}()
+
+	if body := httpGetBody(t, http.DefaultClient, address+"/b"); body != "b" {
+		t.Errorf("Expected %s, got %s", "b", body)
+	}
+	if app.ShuttingDown() {
+		t.Errorf("Expected the application not to be shutting down")
+	}
+	if err := app.Serve(listener); err != ErrAlreadyServing {
+		t.Errorf("Expected %v, got %v", ErrAlreadyServing, err)
+	}
+
+	// The in-flight request completes before the server stops.
+	slow := make(chan string, 1)
+	go func() {
+		slow <- httpGetBody(t, http.DefaultClient, address+"/a/slow")
+	}()
+	<-controller.started
+	stopping := make(chan bool)
+	app.Server().RegisterOnShutdown(func() { close(stopping) })
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- app.Shutdown(context.Background())
+	}()
+	<-stopping
+	controller.release <- true
+	if body := <-slow; body != "slow" {
+		t.Errorf("Expected %s, got %s", "slow", body)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+	if err := <-served; err == nil || err.Error() != "failed" {
+		t.Errorf("Expected the shutdown hook error, got %v", err)
+	}
+
+	expected := []string{"start app 1", "start app 2", "start a", "start b", "shutdown b", "shutdown a", "shutdown app 2", "shutdown app 1"}
+	if !reflect.DeepEqual(events(), expected) {
+		t.Errorf("Expected %v, got %v", expected, events())
+	}
+	if _, err := http.Get(address + "/b"); err == nil {
+		t.Errorf("Expected the server to be stopped")
+	}
+}
+
+func TestServeShutdownDelay(t *testing.T) {
+	app, _, _ := newServerTestApplication()
+	app.SetShutdownDelay(200 * time.Millisecond)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := "http://" + listener.Addr().String()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Serve(listener)
+	}()
+	readiness := func() int {
+		response, err := http.Get(address + "/readyz")
+		if err != nil {
+			return 0
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	if status := readiness(); status != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, status)
+	}
+
+	app.lifecycle.mutex.Lock()
+	draining := app.lifecycle.draining
+	app.lifecycle.mutex.Unlock()
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- app.Shutdown(context.Background())
+	}()
+	<-draining
+
+	// The server still accepts requests, but it is no longer ready.
+	if status := readiness(); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d, got %d", http.StatusServiceUnavailable, status)
+	}
+	if body := httpGetBody(t, http.DefaultClient, address+"/b"); body != "b" {
+		t.Errorf("Expected %s, got %s", "b", body)
+	}
+
+	<-shutdown
+	<-served
+	if status := readiness(); status != 0 {
+		t.Errorf("Expected the server to be stopped, got %d", status)
+	}
+}
+
+func TestServeStartError(t *testing.T) {
+	type testCase struct {
+		controller string
+		expected   []string
+	}
+
+	testCases := []testCase{
+		{"a", []string{"start app 1", "start app 2", "start a", "shutdown app 2", "shutdown app 1"}},
+		{"b", []string{"start app 1", "start app 2", "start a", "start b", "shutdown a", "shutdown app 2", "shutdown app 1"}},
+	}
+
+	for i, d := range testCases {
+		app, _, events := newServerTestApplication()
+		controller := app.controllers[d.controller].(*ControllerServerTester)
+		controller.startErr = errors.New("cannot start")
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := app.Serve(listener); err != controller.startErr {
+			t.Errorf("Test %d: Expected %v, got %v", i, controller.startErr, err)
+		}
+		if !reflect.DeepEqual(events(), d.expected) {
+			t.Errorf("Test %d: Expected %v, got %v", i, d.expected, events())
+		}
+		if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+			t.Errorf("Test %d: Expected the listener to be closed", i)
+		}
+	}
+
+	// Nothing is shut down if the first start hook fails.
+	app, _, events := newServerTestApplication()
+	startErr := errors.New("cannot start")
+	app.lifecycle.startHooks = []func() error{func() error { return startErr }}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Serve(listener); err != startErr {
+		t.Errorf("Expected %v, got %v", startErr, err)
+	}
+	if len(events()) != 0 {
+		t.Errorf("Expected no events, got %v", events())
+	}
+}
+
+func TestRunUnixSocket(t *testing.T) {
+	app, _, _ := newServerTestApplication()
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	served := runListening(t, app, "unix:"+socket)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	if body := httpGetBody(t, client, "http://app/b"); body != "b" {
+		t.Errorf("Expected %s, got %s", "b", body)
+	}
+
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+	<-served
+}
+
+func TestRunUnixSocketLeftOver(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+
+	// A socket still served by another process is not removed.
+	other, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, _, _ := newServerTestApplication()
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Run("unix:" + socket)
+	}()
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Errorf("Expected an error")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the socket not to be replaced")
+		app.Shutdown(context.Background())
+		<-served
+	}
+	if conn, err := net.Dial("unix", socket); err != nil {
+		t.Errorf("Expected the socket to be kept, got %s", err)
+	} else {
+		conn.Close()
+	}
+
+	// A socket left over by a process that has exited is replaced.
+	other.(*net.UnixListener).SetUnlinkOnClose(false)
+	other.Close()
+	app, _, _ = newServerTestApplication()
+	served = runListening(t, app, "unix:"+socket)
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	} else {
+		conn.Close()
+	}
+	app.Shutdown(context.Background())
+	<-served
+}
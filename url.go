@@ -0,0 +1,144 @@
+package ripple
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Returned by URLFor() when no route leads to the action.
+var ErrNoRoute = errors.New("no route matches the action")
+
+type reverseRouteCandidate struct {
+	route    Route
+	segments []string
+	used     map[string]bool
+}
+
+// Builds the URL of a controller action from the routes of the application
+// (reverse routing). The parameters are placed in the path when the route has
+// a matching ":name" token, and in the query string otherwise. When several
+// routes lead to the action, the one that uses the most parameters is chosen.
+// The returned URL includes the base URL of the application. For example:
+//
+//	app.URLFor("users", "friends", map[string]string{"id": "1", "page": "2"})
+//	// "/users/1/friends?page=2"
+//
+// Returns ErrNoRoute if the controller or action does not exist, or if no
+// route leads to it.
+func (this *Application) URLFor(controllerName string, actionName string, params map[string]string) (string, error) {
+	output, _, err := this.urlFor(controllerName, actionName, params)
+	return output, err
+}
+
+// Implementation of URLFor(). Also returns the chosen route candidate.
+func (this *Application) urlFor(controllerName string, actionName string, params map[string]string) (string, reverseRouteCandidate, error) {
+	if _, ok := this.controllers[controllerName]; !ok {
+		return "", reverseRouteCandidate{}, ErrNoRoute
+	}
+
+	var candidates []reverseRouteCandidate
+	// Later routes take precedence when matching, so they come first.
+	for i := len(this.routes) - 1; i >= 0; i-- {
+		segments, used, ok := reverseRoute(this.routes[i], controllerName, actionName, params)
+		if ok {
+			candidates = append(candidates, reverseRouteCandidate{this.routes[i], segments, used})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].used) > len(candidates[j].used)
+	})
+
+	basePath := strings.TrimSuffix(this.parsedBaseUrl.Path, "/")
+	for _, candidate := range candidates {
+		escaped := make([]string, len(candidate.segments))
+		for i, segment := range candidate.segments {
+			escaped[i] = url.PathEscape(segment)
+		}
+		output := &url.URL{
+			Path:    basePath + "/" + strings.Join(candidate.segments, "/"),
+			RawPath: basePath + "/" + strings.Join(escaped, "/"),
+		}
+		if !this.matchesAction(output, controllerName, actionName, params, candidate) {
+			continue
+		}
+		query := url.Values{}
+		for name, value := range params {
+			if !candidate.used[name] {
+				query.Set(name, value)
+			}
+		}
+		output.RawQuery = query.Encode()
+		return output.String(), candidate, nil
+	}
+	return "", reverseRouteCandidate{}, ErrNoRoute
+}
+
+// Fills the tokens of the route pattern. Returns the path segments and the
+// names of the parameters that have been used, or false if the route cannot
+// lead to the action.
+func reverseRoute(route Route, controllerName string, actionName string, params map[string]string) ([]string, map[string]bool, bool) {
+	var segments []string
+	used := make(map[string]bool)
+	controllerInPattern := false
+	actionInPattern := false
+	for _, token := range splitPath(route.Pattern) {
+		if token == ":_controller" {
+			controllerInPattern = true
+			segments = append(segments, controllerName)
+		} else if token == ":_action" {
+			if actionName == "" {
+				return nil, nil, false
+			}
+			actionInPattern = true
+			segments = append(segments, actionName)
+		} else if token[0] == ':' {
+			value := params[token[1:]]
+			if value == "" {
+				return nil, nil, false
+			}
+			used[token[1:]] = true
+			segments = append(segments, value)
+		} else {
+			segments = append(segments, token)
+		}
+	}
+	if !controllerInPattern && route.Controller != controllerName {
+		return nil, nil, false
+	}
+	if !actionInPattern && route.Action != actionName {
+		return nil, nil, false
+	}
+	return segments, used, true
+}
+
+// Tells whether the URL leads to the action through the route of the
+// candidate, with the given path parameters, for at least one request method.
+func (this *Application) matchesAction(u *url.URL, controllerName string, actionName string, params map[string]string, candidate reverseRouteCandidate) bool {
+	for _, requestMethod := range this.requestMethods() {
+		request := &http.Request{Method: requestMethod, URL: u, Header: http.Header{}}
+		match := this.matchRequest(request)
+		if !match.Success || match.ControllerName != controllerName || match.ActionName != actionName || !sameRoute(match.MatchedRoute, candidate.route) {
+			continue
+		}
+		matched := true
+		for name := range candidate.used {
+			if match.Params[name] != params[name] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Tells whether the two routes are the same. Routes are not comparable
+// because of their middlewares.
+func sameRoute(a Route, b Route) bool {
+	return a.Pattern == b.Pattern && a.Controller == b.Controller && a.Action == b.Action && a.group == b.group
+}
@@ -0,0 +1,46 @@
+package ripple
+
+import (
+	"testing"
+)
+
+func TestURLFor(t *testing.T) {
+	app := NewApplication()
+	app.SetBaseUrl("/api/")
+	app.RegisterController("testers", &ControllerTesters{})
+	app.RegisterController("other", &ControllerTesters4{})
+	app.AddRoute(Route{Pattern: ":_controller"})
+	app.AddRoute(Route{Pattern: ":_controller/:id"})
+	app.AddRoute(Route{Pattern: ":_controller/:id/:_action"})
+	app.AddRoute(Route{Pattern: "misc", Controller: "other", Action: "other"})
+
+	type testCase struct {
+		controller string
+		action     string
+		params     map[string]string
+		expected   string
+		success    bool
+	}
+
+	testCases := []testCase{
+		{"testers", "", nil, "/api/testers", true},
+		{"testers", "", map[string]string{"id": "1"}, "/api/testers/1", true},
+		{"testers", "", map[string]string{"id": "1", "page": "2"}, "/api/testers/1?page=2", true},
+		{"testers", "", map[string]string{"id": "a b"}, "/api/testers/a%20b", true},
+		{"testers", "", map[string]string{"id": "a/b"}, "/api/testers/a%2Fb", true},
+		{"testers", "tasks", map[string]string{"id": "1"}, "/api/testers/1/tasks", true},
+		{"other", "other", nil, "/api/misc", true},
+		{"testers", "tasks", nil, "", false},
+		{"nope", "", nil, "", false},
+	}
+
+	for i, d := range testCases {
+		u, err := app.URLFor(d.controller, d.action, d.params)
+		if (err == nil) != d.success {
+			t.Errorf("Test %d: Expected success %t, got error %v", i, d.success, err)
+		}
+		if u != d.expected {
+			t.Errorf("Test %d: Expected %s, got %s", i, d.expected, u)
+		}
+	}
+}
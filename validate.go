@@ -0,0 +1,171 @@
+package ripple
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The kinds of problem reported by Application.Validate().
+const (
+	// The route leads to no action, or all its actions are hidden by routes
+	// added after it.
+	RouteUnreachable = "unreachable"
+	// Some of the actions of the route are hidden by a route added after it.
+	RouteShadowed = "shadowed"
+	// Two routes match some of the same requests, which go to the route added
+	// last. For example, "GET /users/new" matches both ":_controller/:id" and
+	// ":_controller/:_action".
+	RouteAmbiguous = "ambiguous"
+	// The controller action cannot be reached through any route.
+	ActionUnrouted = "unrouted"
+)
+
+// A problem found by Application.Validate().
+type RouteIssue struct {
+	// One of RouteUnreachable, RouteShadowed, RouteAmbiguous or ActionUnrouted.
+	Kind    string
+	Message string
+	// The index of the route concerned, or -1 for ActionUnrouted.
+	RouteIndex int
+}
+
+func (this RouteIssue) String() string {
+	return this.Kind + ": " + this.Message
+}
+
+// Analyses the routes against the registered controllers, and returns the
+// routes that can never be reached, the routes that overlap and the actions
+// that no route leads to. Since routes are usually set up at startup, it can
+// be called from a unit test:
+//
+//	func TestRoutes(t *testing.T) {
+//		for _, issue := range NewApplication().Validate() {
+//			t.Error(issue)
+//		}
+//	}
+func (this *Application) Validate() []RouteIssue {
+	var controllerNames []string
+	for name := range this.controllers {
+		controllerNames = append(controllerNames, name)
+	}
+	sort.Strings(controllerNames)
+
+	entries := make([][]RouteEntry, len(this.routes))
+	for routeIndex, route := range this.routes {
+		for _, controllerName := range controllerNames {
+			entries[routeIndex] = append(entries[routeIndex], this.expandRoute(route, controllerName)...)
+		}
+	}
+
+	var output []RouteIssue
+	for i, route := range this.routes {
+		if len(entries[i]) == 0 {
+			output = append(output, RouteIssue{RouteUnreachable, fmt.Sprintf("route #%d \"%s\" does not lead to any action", i, route.Pattern), i})
+			continue
+		}
+
+		var shadowed []string
+		ambiguous := make(map[int]string)
+		for _, e := range entries[i] {
+			hidden := false
+			for j := i + 1; j < len(this.routes) && !hidden; j++ {
+				for _, f := range entries[j] {
+					if e.Method != f.Method || !pathsOverlap(e.Path, f.Path) {
+						continue
+					}
+					if pathCovers(f.Path, e.Path) {
+						shadowed = append(shadowed, fmt.Sprintf("%s %s (by #%d \"%s\")", e.Method, e.Path, j, this.routes[j].Pattern))
+						hidden = true
+						break
+					}
+					if _, ok := ambiguous[j]; !ok {
+						ambiguous[j] = e.Method + " " + overlapPath(e.Path, f.Path)
+					}
+				}
+			}
+		}
+
+		if len(shadowed) == len(entries[i]) {
+			output = append(output, RouteIssue{RouteUnreachable, fmt.Sprintf("route #%d \"%s\" is hidden by later routes: %s", i, route.Pattern, strings.Join(shadowed, ", ")), i})
+			continue
+		}
+		for _, s := range shadowed {
+			output = append(output, RouteIssue{RouteShadowed, fmt.Sprintf("route #%d \"%s\": %s", i, route.Pattern, s), i})
+		}
+		var others []int
+		for j := range ambiguous {
+			others = append(others, j)
+		}
+		sort.Ints(others)
+		for _, j := range others {
+			output = append(output, RouteIssue{RouteAmbiguous, fmt.Sprintf("routes #%d \"%s\" and #%d \"%s\" overlap: %s goes to #%d", i, route.Pattern, j, this.routes[j].Pattern, ambiguous[j], j), i})
+		}
+	}
+
+	routed := make(map[string]bool)
+	for _, entry := range this.Routes() {
+		routed[entry.Controller+"."+entry.MethodName] = true
+	}
+	for _, controllerName := range controllerNames {
+		t := reflect.TypeOf(this.controllers[controllerName])
+		for i := 0; i < t.NumMethod(); i++ {
+			method := t.Method(i)
+			if !isActionMethod(method) {
+				continue
+			}
+			requestMethod, _, _ := parseMethodName(method.Name)
+			if !containsString(standardMethods, requestMethod) || routed[controllerName+"."+method.Name] {
+				continue
+			}
+			output = append(output, RouteIssue{ActionUnrouted, fmt.Sprintf("no route leads to %s.%s", controllerName, method.Name), -1})
+		}
+	}
+
+	return output
+}
+
+// Tells whether at least one request path matches both paths, given that a
+// ":name" segment matches any value.
+func pathsOverlap(a string, b string) bool {
+	aTokens := splitPath(a)
+	bTokens := splitPath(b)
+	if len(aTokens) != len(bTokens) {
+		return false
+	}
+	for i := range aTokens {
+		if aTokens[i][0] != ':' && bTokens[i][0] != ':' && aTokens[i] != bTokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Tells whether all the request paths matched by inner are also matched by
+// outer.
+func pathCovers(outer string, inner string) bool {
+	outerTokens := splitPath(outer)
+	innerTokens := splitPath(inner)
+	if len(outerTokens) != len(innerTokens) {
+		return false
+	}
+	for i := range outerTokens {
+		if outerTokens[i][0] != ':' && outerTokens[i] != innerTokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the most specific path matched by both paths.
+func overlapPath(a string, b string) string {
+	aTokens := splitPath(a)
+	bTokens := splitPath(b)
+	for i := range aTokens {
+		if aTokens[i][0] == ':' {
+			aTokens[i] = bTokens[i]
+		}
+	}
+	return "/" + strings.Join(aTokens, "/")
+}
@@ -0,0 +1,90 @@
+package ripple
+
+import (
+	"reflect"
+	"testing"
+)
+
+type ControllerValidateTester struct{}
+
+func (this *ControllerValidateTester) Get(ctx *Context)        {}
+func (this *ControllerValidateTester) GetNew(ctx *Context)     {}
+func (this *ControllerValidateTester) GetFriends(ctx *Context) {}
+func (this *ControllerValidateTester) Delete(ctx *Context)     {}
+
+func TestValidate(t *testing.T) {
+	type testCase struct {
+		routes   []Route
+		expected []string
+	}
+
+	testCases := []testCase{
+		{
+			[]Route{
+				{Pattern: ":_controller"},
+				{Pattern: ":_controller/:id"},
+			},
+			[]string{
+				"unrouted: no route leads to users.GetFriends",
+				"unrouted: no route leads to users.GetNew",
+			},
+		},
+		{
+			[]Route{
+				{Pattern: "users/new", Controller: "users", Action: "new"},
+				{Pattern: ":_controller/:id"},
+				{Pattern: "users/:id/friends", Controller: "users", Action: "friends"},
+				{Pattern: "users/nothing", Controller: "users", Action: "nothing"},
+				{Pattern: ":_controller"},
+			},
+			[]string{
+				"unreachable: route #0 \"users/new\" is hidden by later routes: GET /users/new (by #1 \":_controller/:id\")",
+				"unreachable: route #3 \"users/nothing\" does not lead to any action",
+			},
+		},
+		{
+			[]Route{
+				{Pattern: ":_controller/:id"},
+				{Pattern: ":_controller/:_action"},
+			},
+			[]string{
+				"ambiguous: routes #0 \":_controller/:id\" and #1 \":_controller/:_action\" overlap: GET /tasks/other goes to #1",
+			},
+		},
+		{
+			[]Route{
+				{Pattern: ":_controller/:id"},
+				{Pattern: "users/:userId", Controller: "users"},
+				{Pattern: ":_controller/:id/:_action"},
+			},
+			[]string{
+				"shadowed: route #0 \":_controller/:id\": DELETE /users/:id (by #1 \"users/:userId\")",
+				"shadowed: route #0 \":_controller/:id\": GET /users/:id (by #1 \"users/:userId\")",
+			},
+		},
+	}
+
+	for i, d := range testCases {
+		app := NewApplication()
+		app.RegisterController("users", &ControllerValidateTester{})
+		app.RegisterController("tasks", &ControllerTesters4{})
+		for _, route := range d.routes {
+			app.AddRoute(route)
+		}
+		var issues []string
+		for _, issue := range app.Validate() {
+			if issue.Kind == ActionUnrouted && issue.RouteIndex != -1 {
+				t.Errorf("Test %d: Expected route index -1, got %d", i, issue.RouteIndex)
+			}
+			// The "tasks" controller is only there to check that the
+			// wildcard routes do not report false positives.
+			if issue.Kind == ActionUnrouted && issue.Message == "no route leads to tasks.GetOther" {
+				continue
+			}
+			issues = append(issues, issue.String())
+		}
+		if !reflect.DeepEqual(issues, d.expected) {
+			t.Errorf("Test %d: Expected %q, got %q", i, d.expected, issues)
+		}
+	}
+}